@@ -0,0 +1,196 @@
+// api.go
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	apiDefaultLimit = 100
+	apiMaxLimit     = 1000
+)
+
+// OrdersPage — ответ GET /api/orders
+type OrdersPage struct {
+	Orders     []Order `json:"orders"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// orderCursor — позиция в выдаче, отсортированной по (date_created, id) по убыванию
+type orderCursor struct {
+	DateCreated time.Time
+	ID          int64
+}
+
+func (c orderCursor) encode() string {
+	raw := c.DateCreated.UTC().Format(time.RFC3339Nano) + "|" + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (orderCursor, error) {
+	var c orderCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errors.New("некорректный cursor")
+	}
+	date, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return c, errors.New("некорректный cursor")
+	}
+	if c.DateCreated, err = time.Parse(time.RFC3339Nano, date); err != nil {
+		return c, errors.New("некорректный cursor")
+	}
+	if c.ID, err = strconv.ParseInt(id, 10, 64); err != nil {
+		return c, errors.New("некорректный cursor")
+	}
+	return c, nil
+}
+
+// parseAPITime принимает дату (ГГГГ-ММ-ДД) или время в RFC 3339;
+// dateOnly сообщает, что задана только дата
+func parseAPITime(name, v string) (t time.Time, dateOnly bool, err error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("некорректное значение %s %q", name, v)
+}
+
+func parseAPIInt(name, v string) (*int, error) {
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("некорректное значение %s %q", name, v)
+	}
+	return &n, nil
+}
+
+// parseAPIFilter разбирает фильтры GET /api/orders
+func parseAPIFilter(q url.Values) (OrderFilter, error) {
+	var f OrderFilter
+	var err error
+
+	if v := q.Get("date_from"); v != "" {
+		if f.DateFrom, _, err = parseAPITime("date_from", v); err != nil {
+			return f, err
+		}
+	}
+	if v := q.Get("date_to"); v != "" {
+		var dateOnly bool
+		if f.DateTo, dateOnly, err = parseAPITime("date_to", v); err != nil {
+			return f, err
+		}
+		if dateOnly {
+			f.DateTo = f.DateTo.AddDate(0, 0, 1) // включая весь день date_to, как в списке
+		}
+	}
+	if f.AmountMin, err = parseAPIInt("amount_min", q.Get("amount_min")); err != nil {
+		return f, err
+	}
+	if f.AmountMax, err = parseAPIInt("amount_max", q.Get("amount_max")); err != nil {
+		return f, err
+	}
+	f.CustomerID = q.Get("customer_id")
+	f.DeliveryService = q.Get("delivery_service")
+	f.TrackNumber = q.Get("track_number")
+	return f, nil
+}
+
+// queryOrdersAfter возвращает до limit заказов с позициями, следующих за cursor
+// в порядке (date_created, id) по убыванию
+func queryOrdersAfter(ctx context.Context, f OrderFilter, cursor *orderCursor, limit int) ([]Order, error) {
+	where, args := f.where()
+	if cursor != nil {
+		args = append(args, cursor.DateCreated, cursor.ID)
+		cond := fmt.Sprintf("(date_created, id) < ($%d, $%d)", len(args)-1, len(args))
+		if where == "" {
+			where = " WHERE " + cond
+		} else {
+			where += " AND " + cond
+		}
+	}
+	args = append(args, limit)
+
+	query := fmt.Sprintf(`SELECT %s FROM orders%s ORDER BY date_created DESC, id DESC LIMIT $%d`,
+		orderColumns, where, len(args))
+	rows, err := DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []Order{}
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return orders, attachItems(ctx, orders)
+}
+
+// GET /api/orders — заказы с фильтрами и курсорной пагинацией
+func apiOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter, err := parseAPIFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := apiDefaultLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > apiMaxLimit {
+			http.Error(w, fmt.Sprintf("limit должен быть от 1 до %d", apiMaxLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	var cursor *orderCursor
+	if v := q.Get("cursor"); v != "" {
+		c, err := decodeCursor(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cursor = &c
+	}
+
+	// Запрашиваем на один заказ больше, чтобы понять, есть ли следующая страница
+	orders, err := queryOrdersAfter(r.Context(), filter, cursor, limit+1)
+	if err != nil {
+		logFromContext(r.Context()).Error("Ошибка чтения заказов для API", errAttr(err))
+		http.Error(w, "Ошибка чтения из БД", http.StatusInternalServerError)
+		return
+	}
+
+	page := OrdersPage{Orders: orders}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		last := page.Orders[limit-1]
+		page.NextCursor = orderCursor{DateCreated: last.DateCreated, ID: last.ID}.encode()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
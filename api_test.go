@@ -0,0 +1,119 @@
+// api_test.go
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseAPITime(t *testing.T) {
+	msk := time.FixedZone("MSK", 3*60*60)
+	tests := []struct {
+		value    string
+		want     time.Time
+		dateOnly bool
+		wantErr  bool
+	}{
+		{"2021-11-26", time.Date(2021, 11, 26, 0, 0, 0, 0, time.UTC), true, false},
+		{"2021-11-26T06:22:19Z", time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC), false, false},
+		{"2021-11-26T09:22:19+03:00", time.Date(2021, 11, 26, 9, 22, 19, 0, msk), false, false},
+		{"2021-11-26T06:22:19.5Z", time.Date(2021, 11, 26, 6, 22, 19, 5e8, time.UTC), false, false},
+		{"2021-11-26 06:22:19", time.Time{}, false, true},
+		{"2021-11-26T06:22:19", time.Time{}, false, true},
+		{"26.11.2021", time.Time{}, false, true},
+		{"2021-02-30", time.Time{}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, dateOnly, err := parseAPITime("date_to", tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ошибка %v, ожидалась ошибка: %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) || dateOnly != tt.dateOnly {
+				t.Fatalf("got %v (dateOnly %v), want %v (dateOnly %v)", got, dateOnly, tt.want, tt.dateOnly)
+			}
+		})
+	}
+}
+
+func TestParseAPIFilter(t *testing.T) {
+	low, high := 100, 5000
+	tests := []struct {
+		name    string
+		query   string
+		want    OrderFilter
+		wantErr bool
+	}{
+		{"empty", "", OrderFilter{}, false},
+		{"date_to includes the whole day", "date_from=2021-11-26&date_to=2021-11-26", OrderFilter{
+			DateFrom: time.Date(2021, 11, 26, 0, 0, 0, 0, time.UTC),
+			DateTo:   time.Date(2021, 11, 27, 0, 0, 0, 0, time.UTC),
+		}, false},
+		{"date_to with time is exact", "date_to=2021-11-26T12:00:00Z", OrderFilter{
+			DateTo: time.Date(2021, 11, 26, 12, 0, 0, 0, time.UTC),
+		}, false},
+		{"same as list", "date_to=2021-11-30", OrderFilter{
+			DateTo: time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC),
+		}, false},
+		{"fields", "customer_id=test&delivery_service=meest&track_number=WBILMTESTTRACK&amount_min=100&amount_max=5000",
+			OrderFilter{CustomerID: "test", DeliveryService: "meest", TrackNumber: "WBILMTESTTRACK", AmountMin: &low, AmountMax: &high}, false},
+		{"bad date_from", "date_from=yesterday", OrderFilter{}, true},
+		{"bad date_to", "date_to=2021-11-26+06:22", OrderFilter{}, true},
+		{"bad amount", "amount_min=1.5", OrderFilter{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseAPIFilter(q)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ожидалась ошибка, получено %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ошибка: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderCursor(t *testing.T) {
+	msk := time.FixedZone("MSK", 3*60*60)
+	cursors := []orderCursor{
+		{DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC), ID: 1},
+		{DateCreated: time.Date(2021, 11, 26, 9, 22, 19, 123456789, msk), ID: 9007199254740993},
+		{DateCreated: time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), ID: 0},
+	}
+	for _, c := range cursors {
+		s := c.encode()
+		got, err := decodeCursor(s)
+		if err != nil {
+			t.Fatalf("decodeCursor(%q): %v", s, err)
+		}
+		if !got.DateCreated.Equal(c.DateCreated) || got.ID != c.ID {
+			t.Fatalf("decodeCursor(encode(%+v)) = %+v", c, got)
+		}
+	}
+
+	for _, s := range []string{
+		"",
+		"not base64!",
+		orderCursor{ID: 1}.encode()[:4],
+		"MjAyMS0xMS0yNlQwNjoyMjoxOVo",      // без id
+		"MjAyMS0xMS0yNnwx",                 // дата без времени
+		"MjAyMS0xMS0yNlQwNjoyMjoxOVp8YWJj", // id не число
+	} {
+		if _, err := decodeCursor(s); err == nil {
+			t.Fatalf("decodeCursor(%q) должен вернуть ошибку", s)
+		}
+	}
+}
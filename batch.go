@@ -0,0 +1,451 @@
+// batch.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/nats-io/stan.go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// pendingOrder — проверенный заказ, ожидающий записи в составе пакета
+type pendingOrder struct {
+	ctx   context.Context
+	msg   *stan.Msg
+	entry *ledgerEntry
+	order Order
+}
+
+// orderBatcher копит заказы от воркеров и записывает их пакетами: до cfg.Batch.Size
+// заказов или не дольше cfg.Batch.Wait с момента поступления первого. Сообщения
+// пакета подтверждаются только после коммита его транзакции.
+//
+// В пакете не бывает двух версий одного заказа: если order_uid уже есть в пакете,
+// пакет сначала записывается. Вместе с распределением по воркерам это сохраняет
+// порядок обновлений каждого заказа.
+type orderBatcher struct {
+	in   chan pendingOrder
+	quit chan struct{}
+	done chan struct{}
+
+	// save записывает собранный пакет — b.flush
+	save func(batch []pendingOrder)
+
+	// ctx записи пакетов; отменяется, если Stop не дождался записи до срока остановки
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Пакетная запись, nil — если batch.enabled выключен
+var batcher *orderBatcher
+
+func newOrderBatcher() *orderBatcher {
+	b := &orderBatcher{
+		in:   make(chan pendingOrder, cfg.Batch.Size),
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	b.save = b.flush
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	go b.run()
+	return b
+}
+
+// Add передаёт заказ в пакет; блокируется, пока предыдущий пакет записывается
+// и очередь заполнена. После Stop заказ отбрасывается без подтверждения сообщения.
+func (b *orderBatcher) Add(p pendingOrder) {
+	select {
+	case b.in <- p:
+	case <-b.quit:
+	}
+}
+
+// Stop записывает накопленный пакет и останавливает batcher.
+// Вызывается после остановки воркеров, пока соединение с NATS ещё открыто.
+// Если пакет не записан до срока ctx, запись прерывается: транзакция откатывается,
+// сообщения пакета не подтверждаются и будут доставлены повторно.
+func (b *orderBatcher) Stop(ctx context.Context) error {
+	close(b.quit)
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
+
+func (b *orderBatcher) run() {
+	defer close(b.done)
+
+	var batch []pendingOrder
+	uids := make(map[string]bool)
+	var deadline <-chan time.Time
+
+	flush := func() {
+		if len(batch) > 0 {
+			b.save(batch)
+		}
+		batch = nil
+		clear(uids)
+		deadline = nil
+	}
+
+	add := func(p pendingOrder) {
+		if uids[p.order.OrderUID] {
+			flush()
+		}
+		if len(batch) == 0 {
+			deadline = time.After(cfg.Batch.Wait)
+		}
+		batch = append(batch, p)
+		uids[p.order.OrderUID] = true
+		if len(batch) >= cfg.Batch.Size {
+			flush()
+		}
+	}
+
+	for {
+		select {
+		case p := <-b.in:
+			add(p)
+		case <-deadline:
+			flush()
+		case <-b.quit:
+			// Заказы, уже переданные воркерами, записываются последним пакетом
+			for {
+				select {
+				case p := <-b.in:
+					add(p)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush записывает пакет одной транзакцией. Если пакет не удалось записать из-за
+// постоянной ошибки, заказы записываются по одному, чтобы в DLQ попал только виновный.
+func (b *orderBatcher) flush(batch []pendingOrder) {
+	// Спан пакета связан со спанами обработки входящих в него сообщений
+	links := make([]trace.Link, 0, len(batch))
+	for _, p := range batch {
+		links = append(links, trace.LinkFromContext(p.ctx))
+	}
+	ctx, span := tracer.Start(b.ctx, "saveBatch",
+		trace.WithLinks(links...),
+		trace.WithAttributes(attribute.Int("batch.size", len(batch))),
+	)
+	defer span.End()
+	logger := logFromContext(ctx).With("batch_size", len(batch))
+
+	orders := make([]*Order, len(batch))
+	entries := make([]*ledgerEntry, len(batch))
+	for i := range batch {
+		orders[i] = &batch[i].order
+		entries[i] = batch[i].entry
+	}
+
+	start := time.Now()
+	var results []string
+	err := withDBRetry(ctx, func() (err error) {
+		results, err = saveBatchToDB(ctx, orders, entries)
+		return err
+	})
+	elapsed := time.Since(start)
+	dbBatchSize.Observe(float64(len(batch)))
+	dbBatchDuration.Observe(elapsed.Seconds())
+
+	if err != nil {
+		span.RecordError(err)
+		if b.ctx.Err() != nil || isInterruptedDBError(err) {
+			// Остановка не дождалась записи: пакет брошен, сообщения придут повторно
+			logger.Warn("Запись пакета прервана остановкой сервиса", errAttr(err), durationAttr(elapsed))
+			return
+		}
+		if isTransientDBError(err) {
+			// Ни одно сообщение не подтверждено — все будут доставлены повторно
+			dbSaveErrors.Add(float64(len(batch)))
+			logger.Error("Ошибка записи пакета в БД", errAttr(err), durationAttr(elapsed))
+			return
+		}
+		logger.Warn("Постоянная ошибка записи пакета, запись по одному заказу", errAttr(err))
+		for i := range batch {
+			storeOrder(batch[i].ctx, batch[i].msg, batch[i].entry, &batch[i].order)
+		}
+		return
+	}
+
+	var unchanged, stale int
+	for i := range batch {
+		p := &batch[i]
+		switch results[i] {
+		case ledgerStale:
+			stale++
+			staleOrder(p.ctx, p.msg, p.entry, &p.order)
+		case ledgerUnchanged:
+			unchanged++
+			orderStored(p.msg, p.order, false)
+		default:
+			orderStored(p.msg, p.order, true)
+		}
+	}
+	ordersDeduplicated.WithLabelValues(dedupUnchanged).Add(float64(unchanged))
+	logger.Info("Пакет заказов сохранён", "unchanged", unchanged, "stale", stale, durationAttr(elapsed))
+}
+
+// itemCopyColumns — колонки order_items, заполняемые через COPY; id и created_at — по умолчанию
+var itemCopyColumns = []string{
+	"order_uid", "chrt_id", "track_number", "price", "rid", "name",
+	"sale", "size", "total_price", "nm_id", "brand", "status",
+}
+
+// saveBatchToDB записывает пакет заказов одной транзакцией на соединении pgx:
+// история версий и позиции пишутся через COPY, upsert заказов и журнал сообщений —
+// одним pgx.Batch. Как и saveToDB, заполняет в заказах id, версию, временные метки
+// и id позиций; заказы, совпадающие с сохранёнными, и устаревшие обновления не
+// перезаписываются. results[i] — итог для orders[i] (ledgerSaved, ledgerUnchanged
+// или ledgerStale), entries[i] — его сообщение. Устаревшие обновления в журнал не
+// попадают: их обрабатывает staleOrder после коммита.
+func saveBatchToDB(ctx context.Context, orders []*Order, entries []*ledgerEntry) (results []string, err error) {
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	err = conn.Raw(func(driverConn interface{}) (err error) {
+		results, err = saveBatchTx(ctx, driverConn.(*stdlib.Conn).Conn(), orders, entries)
+		return err
+	})
+	return results, err
+}
+
+func saveBatchTx(ctx context.Context, conn *pgx.Conn, orders []*Order, entries []*ledgerEntry) (results []string, err error) {
+	uids := make([]string, len(orders))
+	for i, o := range orders {
+		uids[i] = o.OrderUID
+		if o.ContentHash, err = orderContentHash(*o); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// 1. Блокировка заказов; заказы, совпадающие с сохранёнными, и устаревшие
+	//    обновления не перезаписываются. В пакете нет двух обновлений одного заказа.
+	current, err := lockOrdersBatch(ctx, tx, uids)
+	if err != nil {
+		return nil, err
+	}
+	var changed []*Order
+	var changedUIDs []string
+	var versions []Order
+	results = make([]string, len(orders))
+	for i, o := range orders {
+		cur, found := current[o.OrderUID]
+		if found && bytes.Equal(cur.ContentHash, o.ContentHash) {
+			*o = cur
+			results[i] = ledgerUnchanged
+			continue
+		}
+		if found {
+			if _, stale := staleUpdate(*o, cur); stale {
+				results[i] = ledgerStale
+				continue
+			}
+			versions = append(versions, cur)
+		}
+		changed = append(changed, o)
+		changedUIDs = append(changedUIDs, o.OrderUID)
+		results[i] = ledgerSaved
+	}
+
+	// 2. Сохранение текущих версий изменившихся заказов в историю
+	if err := saveVersionsBatch(ctx, tx, versions); err != nil {
+		return nil, fmt.Errorf("сохранение истории заказов: %w", err)
+	}
+
+	// 3. Upsert заказов и журнал сообщений одним обращением к серверу
+	batch := &pgx.Batch{}
+	for _, o := range changed {
+		args, err := orderArgs(o)
+		if err != nil {
+			return nil, err
+		}
+		batch.Queue(upsertOrderSQL, args...)
+	}
+	for i, e := range entries {
+		if e != nil && results[i] != ledgerStale {
+			batch.Queue(recordLedgerSQL, int64(e.seq), e.hash, orders[i].OrderUID, results[i])
+		}
+	}
+	upsertCtx, upsertSpan := startSQLSpan(ctx, "UPSERT", "orders")
+	batchResults := tx.SendBatch(upsertCtx, batch)
+	for _, o := range changed {
+		var natsSeq int64
+		if err = batchResults.QueryRow().Scan(&o.ID, &o.Version, &natsSeq, &o.CreatedAt, &o.UpdatedAt); err != nil {
+			break
+		}
+		o.NatsSeq = uint64(natsSeq)
+	}
+	if closeErr := batchResults.Close(); err == nil {
+		err = closeErr
+	}
+	endSpan(upsertSpan, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(changed) > 0 {
+		if err := replaceItemsBatch(ctx, tx, changed, changedUIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	_, commitSpan := startSQLSpan(ctx, "COMMIT", "orders")
+	err = tx.Commit(ctx)
+	endSpan(commitSpan, err)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// replaceItemsBatch заменяет позиции заказов: удаляет старые, вставляет новые через COPY
+// и перечитывает их, потому что COPY не возвращает id
+func replaceItemsBatch(ctx context.Context, tx pgx.Tx, orders []*Order, uids []string) error {
+	deleteCtx, deleteSpan := startSQLSpan(ctx, "DELETE", "order_items")
+	_, err := tx.Exec(deleteCtx, "DELETE FROM order_items WHERE order_uid = ANY($1)", uids)
+	endSpan(deleteSpan, err)
+	if err != nil {
+		return err
+	}
+
+	var rows [][]interface{}
+	for _, o := range orders {
+		for _, item := range o.Items {
+			rows = append(rows, []interface{}{
+				o.OrderUID, item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name,
+				item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status,
+			})
+		}
+	}
+	copyCtx, copySpan := startSQLSpan(ctx, "COPY", "order_items")
+	_, err = tx.CopyFrom(copyCtx, pgx.Identifier{"order_items"}, itemCopyColumns, pgx.CopyFromRows(rows))
+	endSpan(copySpan, err)
+	if err != nil {
+		return err
+	}
+
+	items, err := tx.Query(ctx, `SELECT `+itemColumns+` FROM order_items WHERE order_uid = ANY($1) ORDER BY id`, uids)
+	if err != nil {
+		return err
+	}
+	defer items.Close()
+	byUID := make(map[string][]Item, len(orders))
+	for items.Next() {
+		item, err := scanItem(items)
+		if err != nil {
+			return err
+		}
+		byUID[item.OrderUID] = append(byUID[item.OrderUID], item)
+	}
+	if err := items.Err(); err != nil {
+		return err
+	}
+	for _, o := range orders {
+		o.Items = byUID[o.OrderUID]
+	}
+	return nil
+}
+
+// lockOrdersBatch — пакетный вариант lockOrderTx: блокирует order_uid заказов (в порядке
+// order_uid, чтобы параллельные транзакции не взаимоблокировались) и читает их вместе
+// с позициями. Заказов, которых ещё нет, в результате нет, но их order_uid тоже заблокированы.
+func lockOrdersBatch(ctx context.Context, tx pgx.Tx, uids []string) (map[string]Order, error) {
+	// unnest возвращает элементы в порядке массива, поэтому блокировки берутся по порядку
+	sorted := slices.Sorted(slices.Values(uids))
+	advisoryCtx, advisorySpan := startSQLSpan(ctx, "ADVISORY LOCK", "orders")
+	_, err := tx.Exec(advisoryCtx, `SELECT pg_advisory_xact_lock(hashtext(uid)) FROM unnest($1::text[]) AS uid`, sorted)
+	endSpan(advisorySpan, err)
+	if err != nil {
+		return nil, err
+	}
+
+	lockCtx, lockSpan := startSQLSpan(ctx, "SELECT FOR UPDATE", "orders")
+	rows, err := tx.Query(lockCtx, `SELECT `+orderColumns+` FROM orders WHERE order_uid = ANY($1) ORDER BY order_uid FOR UPDATE`, uids)
+	if err != nil {
+		endSpan(lockSpan, err)
+		return nil, err
+	}
+	current := make(map[string]Order)
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			rows.Close()
+			endSpan(lockSpan, err)
+			return nil, err
+		}
+		current[order.OrderUID] = order
+	}
+	rows.Close()
+	endSpan(lockSpan, rows.Err())
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(current) == 0 {
+		return current, nil
+	}
+
+	items, err := tx.Query(ctx, `SELECT `+itemColumns+` FROM order_items WHERE order_uid = ANY($1) ORDER BY id`, uids)
+	if err != nil {
+		return nil, err
+	}
+	defer items.Close()
+	for items.Next() {
+		item, err := scanItem(items)
+		if err != nil {
+			return nil, err
+		}
+		o := current[item.OrderUID]
+		o.Items = append(o.Items, item)
+		current[item.OrderUID] = o
+	}
+	return current, items.Err()
+}
+
+// saveVersionsBatch — пакетный вариант saveVersionTx: копирует состояния заказов,
+// прочитанные lockOrdersBatch, в order_versions
+func saveVersionsBatch(ctx context.Context, tx pgx.Tx, current []Order) error {
+	if len(current) == 0 {
+		return nil
+	}
+	versions := make([][]interface{}, 0, len(current))
+	for _, o := range current {
+		snapshot, err := json.Marshal(o)
+		if err != nil {
+			return err
+		}
+		versions = append(versions, []interface{}{o.OrderUID, o.Version, int64(o.NatsSeq), snapshot, o.UpdatedAt})
+	}
+	copyCtx, copySpan := startSQLSpan(ctx, "COPY", "order_versions")
+	_, err := tx.CopyFrom(copyCtx, pgx.Identifier{"order_versions"},
+		[]string{"order_uid", "version", "nats_seq", "snapshot", "valid_from"}, pgx.CopyFromRows(versions))
+	endSpan(copySpan, err)
+	return err
+}
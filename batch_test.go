@@ -0,0 +1,163 @@
+// batch_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// startTestBatcher запускает batcher с размером пакета size и ожиданием wait; вместо записи
+// в БД пакеты (order_uid и версии) передаются в возвращаемый канал
+func startTestBatcher(t *testing.T, size int, wait time.Duration) (*orderBatcher, chan []string) {
+	t.Helper()
+	prev := cfg.Batch
+	t.Cleanup(func() { cfg.Batch = prev })
+	cfg.Batch.Size, cfg.Batch.Wait = size, wait
+
+	flushed := make(chan []string, 16)
+	b := &orderBatcher{
+		in:   make(chan pendingOrder, size),
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	b.save = func(batch []pendingOrder) {
+		var keys []string
+		for _, p := range batch {
+			keys = append(keys, p.order.OrderUID+p.order.CustomerID)
+		}
+		flushed <- keys
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	go b.run()
+	return b, flushed
+}
+
+// batchOrder — заказ для пакета; version попадает в ключ, чтобы различать версии одного заказа
+func batchOrder(uid, version string) pendingOrder {
+	return pendingOrder{ctx: context.Background(), order: Order{OrderUID: uid, CustomerID: version}}
+}
+
+func expectBatch(t *testing.T, flushed chan []string, want ...string) {
+	t.Helper()
+	select {
+	case got := <-flushed:
+		if !slices.Equal(got, want) {
+			t.Fatalf("записан пакет %v, ожидался %v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("пакет %v не записан", want)
+	}
+}
+
+func expectNoBatch(t *testing.T, flushed chan []string) {
+	t.Helper()
+	select {
+	case got := <-flushed:
+		t.Fatalf("записан лишний пакет %v", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func stopBatcher(t *testing.T, b *orderBatcher) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := b.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+}
+
+func TestOrderBatcherSize(t *testing.T) {
+	b, flushed := startTestBatcher(t, 3, time.Hour)
+	for _, uid := range []string{"a", "b", "c", "d"} {
+		b.Add(batchOrder(uid, ""))
+	}
+	expectBatch(t, flushed, "a", "b", "c")
+	expectNoBatch(t, flushed)
+
+	stopBatcher(t, b)
+	expectBatch(t, flushed, "d")
+}
+
+func TestOrderBatcherRepeatedUID(t *testing.T) {
+	b, flushed := startTestBatcher(t, 10, time.Hour)
+	b.Add(batchOrder("a", "1"))
+	b.Add(batchOrder("b", "1"))
+	b.Add(batchOrder("a", "2")) // вторая версия "a" записывается только после первой
+	expectBatch(t, flushed, "a1", "b1")
+
+	b.Add(batchOrder("c", "1"))
+	b.Add(batchOrder("a", "3"))
+	expectBatch(t, flushed, "a2", "c1")
+	expectNoBatch(t, flushed)
+
+	stopBatcher(t, b)
+	expectBatch(t, flushed, "a3")
+}
+
+func TestOrderBatcherDeadline(t *testing.T) {
+	b, flushed := startTestBatcher(t, 10, 30*time.Millisecond)
+	start := time.Now()
+	b.Add(batchOrder("a", ""))
+	b.Add(batchOrder("b", ""))
+	expectBatch(t, flushed, "a", "b")
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Fatalf("пакет записан через %v, раньше batch.wait", elapsed)
+	}
+
+	// Срок отсчитывается заново с первого заказа следующего пакета
+	b.Add(batchOrder("c", ""))
+	expectBatch(t, flushed, "c")
+
+	stopBatcher(t, b)
+	expectNoBatch(t, flushed)
+}
+
+func TestOrderBatcherStop(t *testing.T) {
+	t.Run("flushes pending and drops later adds", func(t *testing.T) {
+		b, flushed := startTestBatcher(t, 10, time.Hour)
+		b.Add(batchOrder("a", ""))
+		stopBatcher(t, b)
+		expectBatch(t, flushed, "a")
+
+		added := make(chan struct{})
+		go func() {
+			for range 20 {
+				b.Add(batchOrder("late", ""))
+			}
+			close(added)
+		}()
+		select {
+		case <-added:
+		case <-time.After(time.Second):
+			t.Fatal("Add после Stop заблокировался")
+		}
+		expectNoBatch(t, flushed)
+	})
+
+	t.Run("respects ctx", func(t *testing.T) {
+		b, _ := startTestBatcher(t, 10, time.Hour)
+		b.Add(batchOrder("a", ""))
+		// Запись, которая длится, пока не отменён ctx batcher. Подменяется до Stop:
+		// пакет с batch.wait = 1h записывается только после закрытия quit.
+		released := make(chan struct{})
+		b.save = func(batch []pendingOrder) {
+			<-b.ctx.Done()
+			close(released)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if err := b.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Stop() = %v, ожидалось превышение срока", err)
+		}
+		select {
+		case <-released:
+		case <-time.After(time.Second):
+			t.Fatal("запись пакета не прервана после срока остановки")
+		}
+	})
+}
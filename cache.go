@@ -0,0 +1,288 @@
+// cache.go
+package main
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OrderLoader читает заказ из постоянного хранилища при промахе кэша
+type OrderLoader func(ctx context.Context, uid string) (Order, bool, error)
+
+// CacheStats — счётчики кэша заказов
+type CacheStats struct {
+	Entries    int    `json:"entries"`
+	MaxEntries int    `json:"max_entries"`
+	Hits       uint64 `json:"hits"`
+	Misses     uint64 `json:"misses"`
+	Evictions  uint64 `json:"evictions"`
+	Expired    uint64 `json:"expired"`
+	LoadErrors uint64 `json:"load_errors"`
+}
+
+// OrderCache — ограниченный по числу записей LRU-кэш заказов с необязательным TTL
+// и дочитыванием из БД при промахе. Поддерживает вторичные индексы по полям
+// secondaryFields (трек, транзакция, клиент, телефон).
+//
+// Кэш полон (Complete), когда в нём все заказы из БД: восстановление загрузило
+// их целиком, а с тех пор ничего не вытеснено и не устарело. Только тогда
+// индексам можно доверять как поиску по БД.
+type OrderCache struct {
+	mu         sync.Mutex
+	maxEntries int           // 0 — без ограничения
+	ttl        time.Duration // 0 — записи не устаревают
+	ll         *list.List    // начало списка — самые свежие по использованию
+	entries    map[string]*list.Element
+	indexes    map[string]orderIndex // поле → значение → множество order_uid
+	loader     OrderLoader
+	stats      CacheStats
+	complete   bool
+}
+
+// orderIndex — множество order_uid для значения вторичного поля
+type orderIndex = map[string]map[string]struct{}
+
+type cacheEntry struct {
+	order   Order
+	expires time.Time
+}
+
+func NewOrderCache(maxEntries int, ttl time.Duration, loader OrderLoader) *OrderCache {
+	indexes := make(map[string]orderIndex, len(secondaryFields))
+	for _, field := range secondaryFields {
+		indexes[field] = make(orderIndex)
+	}
+	return &OrderCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		ll:         list.New(),
+		entries:    make(map[string]*list.Element),
+		indexes:    indexes,
+		loader:     loader,
+	}
+}
+
+// Get возвращает заказ из кэша, а при промахе — из БД, сохраняя результат в кэш
+func (c *OrderCache) Get(ctx context.Context, uid string) (Order, bool) {
+	ctx, span := tracer.Start(ctx, "cache.get", trace.WithAttributes(attribute.String("order.uid", uid)))
+	defer span.End()
+
+	if order, ok := c.Peek(uid); ok {
+		span.SetAttributes(attribute.Bool("cache.hit", true))
+		return order, true
+	}
+	span.SetAttributes(attribute.Bool("cache.hit", false))
+	if c.loader == nil {
+		return Order{}, false
+	}
+
+	order, found, err := c.loader(ctx, uid)
+	if err != nil {
+		span.RecordError(err)
+		c.mu.Lock()
+		c.stats.LoadErrors++
+		c.mu.Unlock()
+		logFromContext(ctx).Error("Ошибка чтения заказа из БД", logKeyOrderUID, uid, errAttr(err))
+		return Order{}, false
+	}
+	if !found {
+		return Order{}, false
+	}
+
+	// Пока шёл запрос, из NATS могла прийти более свежая версия — её не перезаписываем
+	c.mu.Lock()
+	if el, ok := c.entries[uid]; ok {
+		order = el.Value.(*cacheEntry).order
+	} else {
+		// Заказ есть в БД, но его не было в кэше — кэш не полон
+		c.complete = false
+		c.insertLocked(order, true)
+	}
+	c.mu.Unlock()
+	return order, true
+}
+
+// Peek ищет заказ только в кэше, учитывая попадание/промах, но без обращения к БД
+func (c *OrderCache) Peek(uid string) (Order, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[uid]
+	if !ok {
+		c.stats.Misses++
+		return Order{}, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if c.ttl > 0 && time.Now().After(entry.expires) {
+		c.removeLocked(el)
+		c.complete = false
+		c.stats.Expired++
+		c.stats.Misses++
+		return Order{}, false
+	}
+	c.ll.MoveToFront(el)
+	c.stats.Hits++
+	return entry.order, true
+}
+
+// Set добавляет или обновляет заказ как самый свежий
+func (c *OrderCache) Set(order Order) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[order.OrderUID]; ok {
+		entry := el.Value.(*cacheEntry)
+		c.unindexLocked(entry.order)
+		c.indexLocked(order)
+		entry.order = order
+		entry.expires = c.expiry()
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.insertLocked(order, true)
+}
+
+// Warm добавляет заказ при восстановлении кэша: в конец LRU, только если заказа
+// ещё нет и есть свободное место. Возвращает false, когда кэш заполнен.
+func (c *OrderCache) Warm(order Order) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[order.OrderUID]; ok {
+		return true
+	}
+	if c.maxEntries > 0 && c.ll.Len() >= c.maxEntries {
+		return false
+	}
+	c.insertLocked(order, false)
+	return true
+}
+
+// MarkComplete отмечает, что в кэш загружены все заказы из БД. Кэш с TTL полным
+// не считается: записи в нём устаревают.
+func (c *OrderCache) MarkComplete() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.complete = c.ttl <= 0 && c.stats.Evictions == 0
+}
+
+// Complete сообщает, есть ли в кэше все заказы из БД
+func (c *OrderCache) Complete() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.complete
+}
+
+// Lookup возвращает до limit неустаревших заказов из кэша по значению вторичного поля,
+// в порядке sortOrders
+func (c *OrderCache) Lookup(field, value string, limit int) []Order {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	var orders []Order
+	for uid := range c.indexes[field][value] {
+		entry := c.entries[uid].Value.(*cacheEntry)
+		if c.ttl > 0 && now.After(entry.expires) {
+			continue
+		}
+		orders = append(orders, entry.order)
+	}
+	sortOrders(orders)
+	if len(orders) > limit {
+		orders = orders[:limit]
+	}
+	return orders
+}
+
+// Snapshot возвращает копию всех неустаревших заказов в кэше
+func (c *OrderCache) Snapshot() []Order {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	orders := make([]Order, 0, c.ll.Len())
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		entry := el.Value.(*cacheEntry)
+		if c.ttl > 0 && now.After(entry.expires) {
+			continue
+		}
+		orders = append(orders, entry.order)
+	}
+	return orders
+}
+
+func (c *OrderCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *OrderCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.ll.Len()
+	stats.MaxEntries = c.maxEntries
+	return stats
+}
+
+func (c *OrderCache) expiry() time.Time {
+	if c.ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(c.ttl)
+}
+
+func (c *OrderCache) insertLocked(order Order, front bool) {
+	entry := &cacheEntry{order: order, expires: c.expiry()}
+	if front {
+		c.entries[order.OrderUID] = c.ll.PushFront(entry)
+	} else {
+		c.entries[order.OrderUID] = c.ll.PushBack(entry)
+	}
+	c.indexLocked(order)
+
+	for c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		c.removeLocked(c.ll.Back())
+		c.complete = false
+		c.stats.Evictions++
+	}
+}
+
+func (c *OrderCache) removeLocked(el *list.Element) {
+	order := el.Value.(*cacheEntry).order
+	c.ll.Remove(el)
+	delete(c.entries, order.OrderUID)
+	c.unindexLocked(order)
+}
+
+func (c *OrderCache) indexLocked(order Order) {
+	for field, value := range secondaryKeys(order) {
+		if value == "" {
+			continue
+		}
+		uids := c.indexes[field][value]
+		if uids == nil {
+			uids = make(map[string]struct{})
+			c.indexes[field][value] = uids
+		}
+		uids[order.OrderUID] = struct{}{}
+	}
+}
+
+func (c *OrderCache) unindexLocked(order Order) {
+	for field, value := range secondaryKeys(order) {
+		uids := c.indexes[field][value]
+		delete(uids, order.OrderUID)
+		if len(uids) == 0 {
+			delete(c.indexes[field], value)
+		}
+	}
+}
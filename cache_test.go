@@ -0,0 +1,242 @@
+// cache_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// cachedUIDs — order_uid в порядке LRU, от самого свежего
+func cachedUIDs(c *OrderCache) []string {
+	var uids []string
+	for _, o := range c.Snapshot() {
+		uids = append(uids, o.OrderUID)
+	}
+	return uids
+}
+
+// expire делает запись кэша устаревшей
+func expire(c *OrderCache, uid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[uid].Value.(*cacheEntry).expires = time.Now().Add(-time.Second)
+}
+
+func TestOrderCacheEviction(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   func(c *OrderCache)
+		want    []string
+		evicted uint64
+	}{
+		{"under limit", func(c *OrderCache) {
+			c.Set(Order{OrderUID: "a"})
+			c.Set(Order{OrderUID: "b"})
+		}, []string{"b", "a"}, 0},
+		{"oldest evicted", func(c *OrderCache) {
+			c.Set(Order{OrderUID: "a"})
+			c.Set(Order{OrderUID: "b"})
+			c.Set(Order{OrderUID: "c"})
+			c.Set(Order{OrderUID: "d"})
+		}, []string{"d", "c", "b"}, 1},
+		{"get refreshes", func(c *OrderCache) {
+			c.Set(Order{OrderUID: "a"})
+			c.Set(Order{OrderUID: "b"})
+			c.Set(Order{OrderUID: "c"})
+			c.Peek("a")
+			c.Set(Order{OrderUID: "d"})
+		}, []string{"d", "a", "c"}, 1},
+		{"update refreshes without growing", func(c *OrderCache) {
+			c.Set(Order{OrderUID: "a"})
+			c.Set(Order{OrderUID: "b"})
+			c.Set(Order{OrderUID: "c"})
+			c.Set(Order{OrderUID: "a", TrackNumber: "NEW"})
+			c.Set(Order{OrderUID: "d"})
+		}, []string{"d", "a", "c"}, 1},
+		{"warm appends until full", func(c *OrderCache) {
+			c.Set(Order{OrderUID: "a"})
+			c.Warm(Order{OrderUID: "b"})
+			c.Warm(Order{OrderUID: "c"})
+			c.Warm(Order{OrderUID: "d"})
+		}, []string{"a", "b", "c"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewOrderCache(3, 0, nil)
+			tt.steps(c)
+			if got := cachedUIDs(c); !slices.Equal(got, tt.want) {
+				t.Fatalf("в кэше %v, ожидалось %v", got, tt.want)
+			}
+			if got := c.Stats().Evictions; got != tt.evicted {
+				t.Fatalf("вытеснено %d, ожидалось %d", got, tt.evicted)
+			}
+		})
+	}
+
+	t.Run("warm reports full", func(t *testing.T) {
+		c := NewOrderCache(1, 0, nil)
+		if !c.Warm(Order{OrderUID: "a"}) || !c.Warm(Order{OrderUID: "a"}) {
+			t.Fatal("Warm должен принимать заказ, пока есть место, и уже загруженный заказ")
+		}
+		if c.Warm(Order{OrderUID: "b"}) {
+			t.Fatal("Warm должен вернуть false для заполненного кэша")
+		}
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		c := NewOrderCache(0, 0, nil)
+		for _, uid := range []string{"a", "b", "c", "d", "e"} {
+			c.Set(Order{OrderUID: uid})
+		}
+		if c.Len() != 5 || c.Stats().Evictions != 0 {
+			t.Fatalf("Len() = %d, вытеснено %d", c.Len(), c.Stats().Evictions)
+		}
+	})
+}
+
+func TestOrderCacheTTL(t *testing.T) {
+	c := NewOrderCache(0, time.Hour, nil)
+	c.Set(Order{OrderUID: "a", TrackNumber: "T1"})
+	c.Set(Order{OrderUID: "b", TrackNumber: "T1"})
+	expire(c, "a")
+
+	if got := cachedUIDs(c); !slices.Equal(got, []string{"b"}) {
+		t.Fatalf("Snapshot() = %v, устаревший заказ должен быть пропущен", got)
+	}
+	if got := c.Lookup(searchTrack, "T1", 10); len(got) != 1 || got[0].OrderUID != "b" {
+		t.Fatalf("Lookup() = %v, устаревший заказ должен быть пропущен", got)
+	}
+	if _, ok := c.Peek("a"); ok {
+		t.Fatal("Peek вернул устаревший заказ")
+	}
+	if c.Len() != 1 || c.Stats().Expired != 1 {
+		t.Fatalf("Len() = %d, Expired = %d; устаревший заказ должен быть удалён при чтении", c.Len(), c.Stats().Expired)
+	}
+	if _, ok := c.indexes[searchTrack]["T1"]["a"]; ok {
+		t.Fatal("устаревший заказ остался в индексе")
+	}
+
+	c.Set(Order{OrderUID: "b", TrackNumber: "T1"})
+	if _, ok := c.Peek("b"); !ok {
+		t.Fatal("Set должен продлевать срок жизни записи")
+	}
+}
+
+func TestOrderCacheIndexes(t *testing.T) {
+	c := NewOrderCache(2, 0, nil)
+	c.Set(Order{OrderUID: "a", TrackNumber: "T1", CustomerID: "alice", DeliveryPhone: "+7 (900) 000-00-00"})
+	c.Set(Order{OrderUID: "b", TrackNumber: "T1", CustomerID: "bob"})
+
+	lookup := func(field, value string) []string {
+		var uids []string
+		for _, o := range c.Lookup(field, value, 10) {
+			uids = append(uids, o.OrderUID)
+		}
+		slices.Sort(uids)
+		return uids
+	}
+
+	if got := lookup(searchTrack, "T1"); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("по трек-номеру %v", got)
+	}
+	if got := lookup(searchPhone, "79000000000"); !slices.Equal(got, []string{"a"}) {
+		t.Fatalf("по телефону %v", got)
+	}
+
+	// Изменённое поле переиндексируется
+	c.Set(Order{OrderUID: "b", TrackNumber: "T2", CustomerID: "bob"})
+	if got := lookup(searchTrack, "T1"); !slices.Equal(got, []string{"a"}) {
+		t.Fatalf("после смены трек-номера по старому значению %v", got)
+	}
+
+	// Вытесненный заказ пропадает из всех индексов, пустые значения удаляются
+	c.Set(Order{OrderUID: "c", TrackNumber: "T3"})
+	if got := lookup(searchCustomer, "alice"); got != nil {
+		t.Fatalf("вытесненный заказ найден по customer_id: %v", got)
+	}
+	for field, index := range c.indexes {
+		for value, uids := range index {
+			if _, ok := uids["a"]; ok {
+				t.Fatalf("вытесненный заказ остался в индексе %s=%s", field, value)
+			}
+			if len(uids) == 0 {
+				t.Fatalf("пустое значение %s=%s осталось в индексе", field, value)
+			}
+		}
+	}
+	if got := lookup(searchTrack, "T1"); got != nil {
+		t.Fatalf("по трек-номеру вытесненного заказа %v", got)
+	}
+}
+
+func TestOrderCacheReadThrough(t *testing.T) {
+	db := map[string]Order{"a": {OrderUID: "a", TrackNumber: "T1"}}
+	loads := 0
+	loader := func(ctx context.Context, uid string) (Order, bool, error) {
+		loads++
+		if uid == "broken" {
+			return Order{}, false, errors.New("нет соединения")
+		}
+		o, ok := db[uid]
+		return o, ok, nil
+	}
+
+	c := NewOrderCache(10, 0, loader)
+	ctx := context.Background()
+
+	if o, ok := c.Get(ctx, "a"); !ok || o.TrackNumber != "T1" {
+		t.Fatalf("Get(a) = %v, %v", o, ok)
+	}
+	if _, ok := c.Get(ctx, "a"); !ok || loads != 1 {
+		t.Fatalf("повторный Get должен попасть в кэш, загрузок %d", loads)
+	}
+	if got := c.Lookup(searchTrack, "T1", 10); len(got) != 1 {
+		t.Fatal("дочитанный заказ должен попасть в индексы")
+	}
+	if _, ok := c.Get(ctx, "missing"); ok {
+		t.Fatal("Get нашёл отсутствующий заказ")
+	}
+	if _, ok := c.Get(ctx, "broken"); ok {
+		t.Fatal("Get вернул заказ при ошибке загрузки")
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.Misses != 3 || stats.LoadErrors != 1 || stats.Entries != 1 {
+		t.Fatalf("счётчики %+v", stats)
+	}
+}
+
+func TestOrderCacheComplete(t *testing.T) {
+	loader := func(ctx context.Context, uid string) (Order, bool, error) {
+		return Order{OrderUID: uid}, true, nil
+	}
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		steps func(c *OrderCache)
+		want  bool
+	}{
+		{"restored", 0, func(c *OrderCache) {}, true},
+		{"new orders keep it", 0, func(c *OrderCache) { c.Set(Order{OrderUID: "b"}) }, true},
+		{"with ttl", time.Hour, func(c *OrderCache) {}, false},
+		{"eviction", 0, func(c *OrderCache) {
+			c.Set(Order{OrderUID: "b"})
+			c.Set(Order{OrderUID: "c"})
+		}, false},
+		{"loaded from db", 0, func(c *OrderCache) { c.Get(context.Background(), "x") }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewOrderCache(2, tt.ttl, loader)
+			c.Warm(Order{OrderUID: "a"})
+			c.MarkComplete()
+			tt.steps(c)
+			if got := c.Complete(); got != tt.want {
+				t.Fatalf("Complete() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
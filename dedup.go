@@ -0,0 +1,146 @@
+// dedup.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/nats-io/stan.go"
+)
+
+// Итог обработки сообщения в журнале processed_messages
+const (
+	ledgerSaved     = "saved"
+	ledgerUnchanged = "unchanged"
+	ledgerRejected  = "rejected"
+	ledgerStale     = "stale"
+)
+
+// ledgerEntry — запись журнала для сообщения, из которого получен заказ
+type ledgerEntry struct {
+	seq  uint64
+	hash []byte
+}
+
+func messageLedgerEntry(msg *stan.Msg) *ledgerEntry {
+	hash := sha256.Sum256(msg.Data)
+	return &ledgerEntry{seq: msg.Sequence, hash: hash[:]}
+}
+
+// isDuplicateMessage — сообщение с тем же номером и содержимым уже обработано
+// (например, подтверждение потерялось и NATS Streaming доставил его снова).
+// Совпадение номера при другом содержимом означает, что хранилище канала
+// пересоздано, и сообщение обрабатывается как новое.
+func isDuplicateMessage(ctx context.Context, e *ledgerEntry) (bool, error) {
+	ctx, span := startSQLSpan(ctx, "SELECT", "processed_messages")
+	var hash []byte
+	err := DB.QueryRowContext(ctx, "SELECT payload_hash FROM processed_messages WHERE nats_seq = $1", int64(e.seq)).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		endSpan(span, nil)
+		return false, nil
+	}
+	endSpan(span, err)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(hash, e.hash), nil
+}
+
+// recordLedgerSQL добавляет сообщение в журнал или перезаписывает запись с тем же номером
+const recordLedgerSQL = `
+	INSERT INTO processed_messages (nats_seq, payload_hash, order_uid, result)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (nats_seq) DO UPDATE SET
+		payload_hash = EXCLUDED.payload_hash,
+		order_uid = EXCLUDED.order_uid,
+		result = EXCLUDED.result,
+		processed_at = NOW()
+`
+
+// execer — общий интерфейс *sql.DB и *sql.Tx для записи в журнал
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// recordMessage записывает сообщение в журнал; в saveToDB — в той же транзакции, что и заказ
+func recordMessage(ctx context.Context, db execer, e *ledgerEntry, uid, result string) error {
+	ctx, span := startSQLSpan(ctx, "INSERT", "processed_messages")
+	_, err := db.ExecContext(ctx, recordLedgerSQL, int64(e.seq), e.hash, uid, result)
+	endSpan(span, err)
+	return err
+}
+
+// Срок хранения журнала, если не заданы ни dedup.retention, ни nats.channel_max_age
+const defaultLedgerRetention = 7 * 24 * time.Hour
+
+// ledgerRetention — срок хранения записей журнала. По умолчанию равен max_age канала:
+// более старые сообщения удалены из канала и доставлены повторно быть не могут.
+func ledgerRetention() time.Duration {
+	switch {
+	case cfg.Dedup.Retention > 0:
+		return cfg.Dedup.Retention
+	case cfg.NATS.ChannelMaxAge > 0:
+		return cfg.NATS.ChannelMaxAge
+	default:
+		return defaultLedgerRetention
+	}
+}
+
+// runLedgerCleanup раз в dedup.cleanup_interval удаляет из журнала записи старше
+// ledgerRetention, пока ctx не отменён
+func runLedgerCleanup(ctx context.Context) {
+	ticker := time.NewTicker(cfg.Dedup.CleanupInterval)
+	defer ticker.Stop()
+	for {
+		if err := cleanupLedger(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("Ошибка очистки журнала сообщений", errAttr(err))
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func cleanupLedger(ctx context.Context) error {
+	retention := ledgerRetention()
+	ctx, span := startSQLSpan(ctx, "DELETE", "processed_messages")
+	res, err := DB.ExecContext(ctx, "DELETE FROM processed_messages WHERE processed_at < NOW() - $1 * INTERVAL '1 second'", int64(retention.Seconds()))
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		ledgerPurged.Add(float64(n))
+		slog.Info("Журнал сообщений очищен", "deleted", n, "retention", retention.String())
+	}
+	return nil
+}
+
+// orderContentHash — хэш содержимого заказа без служебных полей (id, версии, номера
+// и времени сообщения, временных меток записи). Одинаковый заказ, пришедший повторно, даёт тот же хэш.
+func orderContentHash(o Order) ([]byte, error) {
+	o = orderInUTC(o)
+	o.ID, o.Version, o.NatsSeq, o.MessageTime, o.ContentHash = 0, 0, 0, nil, nil
+	o.CreatedAt, o.UpdatedAt = time.Time{}, time.Time{}
+	var items []Item
+	for _, item := range o.Items {
+		item.ID, item.OrderUID, item.CreatedAt = 0, "", time.Time{}
+		items = append(items, item)
+	}
+	o.Items = items
+
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(data)
+	return hash[:], nil
+}
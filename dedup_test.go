@@ -0,0 +1,70 @@
+// dedup_test.go
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestOrderContentHash(t *testing.T) {
+	base := orderFromJSON(testOrder(t))
+	baseHash, err := orderContentHash(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	msk := time.FixedZone("MSK", 3*60*60)
+	tests := []struct {
+		name    string
+		modify  func(o *Order)
+		changed bool
+	}{
+		{"same order", func(o *Order) {}, false},
+		{"service fields", func(o *Order) {
+			o.ID, o.Version, o.NatsSeq = 42, 7, 1001
+			o.MessageTime = &now
+			o.CreatedAt, o.UpdatedAt = now, now
+			o.ContentHash = []byte("old")
+		}, false},
+		{"item service fields", func(o *Order) {
+			o.Items[0].ID, o.Items[0].OrderUID, o.Items[0].CreatedAt = 99, "", now
+		}, false},
+		{"same time in another zone", func(o *Order) {
+			o.DateCreated, o.PaymentDt = o.DateCreated.In(msk), o.PaymentDt.In(msk)
+		}, false},
+		{"track number", func(o *Order) { o.TrackNumber += "X" }, true},
+		{"amount", func(o *Order) { o.PaymentAmount++ }, true},
+		{"date created", func(o *Order) { o.DateCreated = o.DateCreated.Add(time.Second) }, true},
+		{"producer version", func(o *Order) { o.ProducerVersion++ }, true},
+		{"item price", func(o *Order) { o.Items[0].Price++ }, true},
+		{"item status", func(o *Order) { o.Items[0].Status = 0 }, true},
+		{"item added", func(o *Order) { o.Items = append(o.Items, o.Items[0]) }, true},
+		{"items removed", func(o *Order) { o.Items = nil }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := orderFromJSON(testOrder(t))
+			tt.modify(&o)
+			hash, err := orderContentHash(o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed := !bytes.Equal(hash, baseHash); changed != tt.changed {
+				t.Fatalf("хэш изменился: %v, ожидалось %v", changed, tt.changed)
+			}
+		})
+	}
+
+	t.Run("does not modify order", func(t *testing.T) {
+		o := orderFromJSON(testOrder(t))
+		o.ID, o.Items[0].ID = 42, 99
+		if _, err := orderContentHash(o); err != nil {
+			t.Fatal(err)
+		}
+		if o.ID != 42 || o.Items[0].ID != 99 {
+			t.Fatal("orderContentHash изменил переданный заказ")
+		}
+	})
+}
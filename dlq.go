@@ -0,0 +1,201 @@
+// dlq.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nats-io/stan.go"
+)
+
+// RejectedMessage — запись таблицы order_rejects
+type RejectedMessage struct {
+	ID            int64        `json:"id"`
+	NatsSeq       uint64       `json:"nats_seq"`
+	Reason        string       `json:"reason"`
+	Errors        []FieldError `json:"errors,omitempty"`
+	Payload       string       `json:"payload,omitempty"`
+	RejectedAt    time.Time    `json:"rejected_at"`
+	ResubmittedAt *time.Time   `json:"resubmitted_at,omitempty"`
+}
+
+// rejectMessage сохраняет сообщение в order_rejects вместе с ошибками проверки полей
+// и публикует его в DLQ-канал. Если запись в БД не удалась, сообщение подтверждать нельзя.
+func rejectMessage(ctx context.Context, msg *stan.Msg, reason string, fieldErrs ValidationErrors) error {
+	var errsJSON []byte
+	if len(fieldErrs) > 0 {
+		var err error
+		if errsJSON, err = json.Marshal(fieldErrs); err != nil {
+			return err
+		}
+	}
+
+	insertCtx, span := startSQLSpan(ctx, "INSERT", "order_rejects")
+	_, err := DB.ExecContext(insertCtx, `
+		INSERT INTO order_rejects (nats_seq, raw, reason, errors)
+		VALUES ($1, $2, $3, $4)
+	`, int64(msg.Sequence), msg.Data, reason, errsJSON)
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+
+	logger := logFromContext(ctx).With(logKeyNatsSeq, msg.Sequence)
+	if natsConn != nil {
+		if err := natsConn.Publish(cfg.NATS.DLQChannel, msg.Data); err != nil {
+			logger.Warn("Не удалось отправить сообщение в DLQ", "channel", cfg.NATS.DLQChannel, errAttr(err))
+		}
+	}
+
+	logger.Warn("Сообщение отклонено", "reason", reason, "field_errors", fieldErrs)
+	return nil
+}
+
+func listRejects(limit int) ([]RejectedMessage, error) {
+	rows, err := DB.Query(`
+		SELECT id, nats_seq, reason, errors, rejected_at, resubmitted_at
+		FROM order_rejects
+		ORDER BY id DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rejects := []RejectedMessage{}
+	for rows.Next() {
+		var rm RejectedMessage
+		var seq int64
+		var errsJSON []byte
+		if err := rows.Scan(&rm.ID, &seq, &rm.Reason, &errsJSON, &rm.RejectedAt, &rm.ResubmittedAt); err != nil {
+			return nil, err
+		}
+		rm.NatsSeq = uint64(seq)
+		if err := unmarshalFieldErrors(errsJSON, &rm); err != nil {
+			return nil, err
+		}
+		rejects = append(rejects, rm)
+	}
+	return rejects, rows.Err()
+}
+
+func getReject(id int64) (RejectedMessage, []byte, error) {
+	var rm RejectedMessage
+	var seq int64
+	var raw, errsJSON []byte
+	err := DB.QueryRow(`
+		SELECT id, nats_seq, raw, reason, errors, rejected_at, resubmitted_at
+		FROM order_rejects
+		WHERE id = $1
+	`, id).Scan(&rm.ID, &seq, &raw, &rm.Reason, &errsJSON, &rm.RejectedAt, &rm.ResubmittedAt)
+	if err != nil {
+		return rm, nil, err
+	}
+	rm.NatsSeq = uint64(seq)
+	return rm, raw, unmarshalFieldErrors(errsJSON, &rm)
+}
+
+func unmarshalFieldErrors(data []byte, rm *RejectedMessage) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, &rm.Errors)
+}
+
+// GET /api/rejects — список отклонённых сообщений
+func listRejectsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Некорректный limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	rejects, err := listRejects(limit)
+	if err != nil {
+		logFromContext(r.Context()).Error("Ошибка чтения order_rejects", errAttr(err))
+		http.Error(w, "Ошибка чтения из БД", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rejects)
+}
+
+// GET /api/rejects/{id} — отклонённое сообщение вместе с исходными данными
+func rejectDetailHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Некорректный id", http.StatusBadRequest)
+		return
+	}
+
+	rm, raw, err := getReject(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Сообщение не найдено", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logFromContext(r.Context()).Error("Ошибка чтения order_rejects", errAttr(err))
+		http.Error(w, "Ошибка чтения из БД", http.StatusInternalServerError)
+		return
+	}
+	rm.Payload = string(raw)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rm)
+}
+
+// POST /api/rejects/{id}/resubmit — повторная отправка сообщения в канал заказов
+func resubmitRejectHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Некорректный id", http.StatusBadRequest)
+		return
+	}
+
+	_, raw, err := getReject(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Сообщение не найдено", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logFromContext(r.Context()).Error("Ошибка чтения order_rejects", errAttr(err))
+		http.Error(w, "Ошибка чтения из БД", http.StatusInternalServerError)
+		return
+	}
+
+	if natsConn == nil {
+		http.Error(w, "Нет подключения к NATS", http.StatusServiceUnavailable)
+		return
+	}
+	logger := logFromContext(r.Context()).With("reject_id", id)
+
+	// Обработка повторно отправленного сообщения продолжает трассу этого запроса
+	data, err := withMessageContext(r.Context(), raw)
+	if err != nil {
+		logger.Debug("Контекст трассы не добавлен в сообщение", errAttr(err))
+	}
+	if err := natsConn.Publish(cfg.NATS.Channel, data); err != nil {
+		logger.Error("Ошибка повторной отправки сообщения", errAttr(err))
+		http.Error(w, "Ошибка отправки в NATS", http.StatusBadGateway)
+		return
+	}
+
+	if _, err := DB.Exec("UPDATE order_rejects SET resubmitted_at = NOW() WHERE id = $1", id); err != nil {
+		logger.Warn("Не удалось отметить сообщение как отправленное", errAttr(err))
+	}
+
+	logger.Info("Отклонённое сообщение отправлено повторно")
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,179 @@
+// generate.go
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+)
+
+// generatorMarket — страна доставки: локаль, валюта, телефонный код и города
+type generatorMarket struct {
+	locale   string
+	currency string
+	phone    string
+	cities   [][2]string // город, регион
+}
+
+var generatorMarkets = []generatorMarket{
+	{"ru", "RUB", "+7", [][2]string{{"Moskva", "Moskovskaya oblast"}, {"Sankt-Peterburg", "Leningradskaya oblast"}, {"Kazan", "Tatarstan"}, {"Novosibirsk", "Novosibirskaya oblast"}}},
+	{"en", "USD", "+1", [][2]string{{"New York", "NY"}, {"Austin", "TX"}, {"Seattle", "WA"}}},
+	{"kk", "KZT", "+7", [][2]string{{"Almaty", "Almaty"}, {"Astana", "Astana"}}},
+	{"be", "BYN", "+375", [][2]string{{"Minsk", "Minskaya voblasts"}, {"Brest", "Brestskaya voblasts"}}},
+	{"uz", "UZS", "+998", [][2]string{{"Tashkent", "Toshkent"}, {"Samarkand", "Samarqand"}}},
+	{"hy", "AMD", "+374", [][2]string{{"Yerevan", "Yerevan"}, {"Gyumri", "Shirak"}}},
+}
+
+var (
+	generatorFirstNames = []string{"Ivan", "Anna", "Petr", "Maria", "Aleksei", "Olga", "Dmitry", "Elena", "Timur", "Aigerim", "John", "Kate"}
+	generatorLastNames  = []string{"Ivanov", "Petrova", "Sidorov", "Smirnova", "Kuznetsov", "Popova", "Nurlanov", "Hakobyan", "Smith", "Brown"}
+	generatorStreets    = []string{"Lenina", "Mira", "Gagarina", "Sadovaya", "Central", "Abaya", "Pobedy"}
+	generatorServices   = []string{"meest", "cdek", "boxberry", "dpd", "russianpost", "wb"}
+	generatorProviders  = []string{"wbpay", "sbp", "card"}
+	generatorBanks      = []string{"alpha", "sber", "tinkoff", "vtb", "halyk"}
+	generatorSales      = []int{0, 0, 0, 5, 10, 15, 20, 25, 30, 40, 50}
+	generatorDelivery   = []int{0, 300, 500, 1500}
+	generatorStatuses   = []int{202, 202, 202, 200, 201, 203}
+	generatorProducts   = [][2]string{ // название, бренд
+		{"Mascaras", "Vivienne Sabo"}, {"T-shirt", "Befree"}, {"Sneakers", "Nike"}, {"Backpack", "Xiaomi"},
+		{"Headphones", "JBL"}, {"Mug", "Home Story"}, {"Notebook", "Hatber"}, {"Lipstick", "Maybelline"},
+		{"Jeans", "Gloria Jeans"}, {"Power bank", "Baseus"}, {"Kettle", "Polaris"}, {"Socks", "Uniqlo"},
+	}
+	generatorSizes = []string{"0", "S", "M", "L", "XL", "42", "44"}
+)
+
+// generatorEpoch — начало интервала дат заказов; фиксирован, чтобы выборка зависела только от seed
+var generatorEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// orderGenerator создаёт правдоподобные случайные заказы, проходящие validateOrder
+// и reconcileOrder. При одинаковом seed последовательность заказов одинакова.
+type orderGenerator struct {
+	r        *rand.Rand
+	maxItems int
+}
+
+// newOrderGenerator создаёт генератор; seed = 0 — случайное начальное значение
+func newOrderGenerator(seed uint64, maxItems int) *orderGenerator {
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	return &orderGenerator{r: rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15)), maxItems: max(maxItems, 1)}
+}
+
+func (g *orderGenerator) pick(list []string) string {
+	return list[g.r.IntN(len(list))]
+}
+
+func (g *orderGenerator) hex(n int) string {
+	const digits = "0123456789abcdef"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = digits[g.r.IntN(len(digits))]
+	}
+	return string(b)
+}
+
+func (g *orderGenerator) digits(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte('0' + g.r.IntN(10))
+	}
+	return string(b)
+}
+
+// Next возвращает следующий заказ
+func (g *orderGenerator) Next() OrderJSON {
+	market := generatorMarkets[g.r.IntN(len(generatorMarkets))]
+	city := market.cities[g.r.IntN(len(market.cities))]
+	first, last := g.pick(generatorFirstNames), g.pick(generatorLastNames)
+
+	uid := g.hex(16) + "gen"
+	track := "WB" + strings.ToUpper(g.hex(12))
+	created := generatorEpoch.Add(time.Duration(g.r.Int64N(int64(365 * 24 * time.Hour)))).Truncate(time.Second)
+
+	order := OrderJSON{
+		OrderUID:    uid,
+		TrackNumber: track,
+		Entry:       "WBIL",
+		Delivery: Delivery{
+			Name:    first + " " + last,
+			Phone:   market.phone + g.digits(12-len(market.phone)),
+			Zip:     g.digits(6),
+			City:    city[0],
+			Address: fmt.Sprintf("%s %d", g.pick(generatorStreets), 1+g.r.IntN(150)),
+			Region:  city[1],
+			Email:   strings.ToLower(first+"."+last) + g.digits(2) + "@example.com",
+		},
+		Payment: Payment{
+			Transaction:  uid,
+			Currency:     market.currency,
+			Provider:     g.pick(generatorProviders),
+			PaymentDt:    created.Add(time.Duration(1+g.r.IntN(600)) * time.Second).Unix(),
+			Bank:         g.pick(generatorBanks),
+			DeliveryCost: generatorDelivery[g.r.IntN(len(generatorDelivery))],
+		},
+		Locale:          market.locale,
+		CustomerID:      "cust" + g.digits(6),
+		DeliveryService: g.pick(generatorServices),
+		Shardkey:        g.digits(1),
+		SmID:            1 + g.r.IntN(100),
+		DateCreated:     created.Format(time.RFC3339),
+		OofShard:        fmt.Sprint(1 + g.r.IntN(2)),
+	}
+
+	// Суммы согласованы так же, как их проверяет reconcileOrder
+	items := 1 + g.r.IntN(g.maxItems)
+	for i := 0; i < items; i++ {
+		product := generatorProducts[g.r.IntN(len(generatorProducts))]
+		price := 100 + g.r.IntN(20000)
+		sale := generatorSales[g.r.IntN(len(generatorSales))]
+		item := ItemJSON{
+			ChrtID:      1000000 + g.r.Int64N(9000000),
+			TrackNumber: track,
+			Price:       price,
+			Rid:         g.hex(18) + "gen",
+			Name:        product[0],
+			Sale:        sale,
+			Size:        g.pick(generatorSizes),
+			TotalPrice:  int(math.Round(float64(price) * float64(100-sale) / 100)),
+			NmID:        1000000 + g.r.Int64N(9000000),
+			Brand:       product[1],
+			Status:      generatorStatuses[g.r.IntN(len(generatorStatuses))],
+		}
+		order.Items = append(order.Items, item)
+		order.Payment.GoodsTotal += item.TotalPrice
+	}
+	if g.r.IntN(5) == 0 {
+		order.Payment.CustomFee = order.Payment.GoodsTotal * (1 + g.r.IntN(5)) / 100
+	}
+	order.Payment.Amount = order.Payment.GoodsTotal + order.Payment.DeliveryCost + order.Payment.CustomFee
+	return order
+}
+
+// runGenerateCommand — go run . generate [-n N] [-seed S] [-max-items M]: заказы в формате NDJSON в stdout,
+// например для go run . generate -n 1000 | go run . publish ndjson
+func runGenerateCommand(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	n := fs.Int("n", 10, "число заказов")
+	seed := fs.Uint64("seed", 0, "начальное значение генератора, 0 — случайное")
+	maxItems := fs.Int("max-items", 5, "максимум позиций в заказе")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	gen := newOrderGenerator(*seed, *maxItems)
+	w := bufio.NewWriter(os.Stdout)
+	enc := json.NewEncoder(w)
+	for i := 0; i < *n; i++ {
+		if err := enc.Encode(gen.Next()); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
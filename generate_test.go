@@ -0,0 +1,58 @@
+// generate_test.go
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOrderGeneratorValid(t *testing.T) {
+	// Строгая сверка: без допуска, все правила
+	setReconcile(t, reconcileReject, []string{ruleGoodsTotal, ruleAmount, ruleItemTotal}, 0)
+
+	for _, seed := range []uint64{1, 2, 42, 1 << 40} {
+		gen := newOrderGenerator(seed, 5)
+		uids := make(map[string]bool)
+		for i := range 300 {
+			o := gen.Next()
+			if errs := validateOrder(o); len(errs) > 0 {
+				t.Fatalf("seed %d, заказ %d не проходит проверку: %v", seed, i, errs)
+			}
+			if errs := reconcileOrder(o); len(errs) > 0 {
+				t.Fatalf("seed %d, заказ %d не проходит сверку: %v", seed, i, errs)
+			}
+			if len(o.Items) < 1 || len(o.Items) > 5 {
+				t.Fatalf("seed %d, заказ %d: %d позиций при max-items 5", seed, i, len(o.Items))
+			}
+			if uids[o.OrderUID] {
+				t.Fatalf("seed %d: order_uid %s повторился", seed, o.OrderUID)
+			}
+			uids[o.OrderUID] = true
+		}
+	}
+
+	if o := newOrderGenerator(1, 0).Next(); len(o.Items) != 1 {
+		t.Fatalf("max-items 0: %d позиций, ожидалась одна", len(o.Items))
+	}
+}
+
+func TestOrderGeneratorSeed(t *testing.T) {
+	sequence := func(seed uint64) []OrderJSON {
+		gen := newOrderGenerator(seed, 5)
+		orders := make([]OrderJSON, 50)
+		for i := range orders {
+			orders[i] = gen.Next()
+		}
+		return orders
+	}
+
+	if !reflect.DeepEqual(sequence(7), sequence(7)) {
+		t.Fatal("одинаковый seed дал разные заказы")
+	}
+	if reflect.DeepEqual(sequence(7), sequence(8)) {
+		t.Fatal("разные seed дали одинаковые заказы")
+	}
+	if reflect.DeepEqual(sequence(0), sequence(0)) {
+		t.Fatal("seed 0 должен давать случайную последовательность")
+	}
+}
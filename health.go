@@ -0,0 +1,146 @@
+// health.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/stan.go"
+)
+
+var (
+	startedAt = time.Now()
+
+	// Время последнего успешно сохранённого сообщения (UnixNano), 0 — ещё не было
+	lastMessageAt atomic.Int64
+
+	// Соединение с NATS Streaming потеряно (сервер перестал отвечать на ping)
+	natsConnLost atomic.Bool
+
+	// Сервис останавливается и не должен получать новые запросы
+	shuttingDown atomic.Bool
+)
+
+// Таймаут проверки одной зависимости
+const healthCheckTimeout = 2 * time.Second
+
+// DependencyStatus — состояние внешней зависимости
+type DependencyStatus struct {
+	OK        bool    `json:"ok"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ServiceStatus — ответ GET /status
+type ServiceStatus struct {
+	Ready         bool             `json:"ready"`
+	ShuttingDown  bool             `json:"shutting_down"`
+	StartedAt     time.Time        `json:"started_at"`
+	Uptime        string           `json:"uptime"`
+	Postgres      DependencyStatus `json:"postgres"`
+	NATS          DependencyStatus `json:"nats"`
+	CacheWarmed   bool             `json:"cache_warmed"`
+	Cache         CacheStats       `json:"cache"`
+	LastMessageAt *time.Time       `json:"last_message_at,omitempty"`
+}
+
+// onNATSConnectionLost вызывается клиентом STAN при потере соединения с сервером
+func onNATSConnectionLost(_ stan.Conn, err error) {
+	natsConnLost.Store(true)
+	slog.Error("Соединение с NATS Streaming потеряно", errAttr(err))
+}
+
+func checkPostgres(ctx context.Context) DependencyStatus {
+	start := time.Now()
+	err := DB.PingContext(ctx)
+	return dependencyStatus(start, err)
+}
+
+func checkNATS() DependencyStatus {
+	start := time.Now()
+	if natsConn == nil {
+		return dependencyStatus(start, errors.New("нет подключения"))
+	}
+	if natsConnLost.Load() {
+		return dependencyStatus(start, errors.New("соединение потеряно"))
+	}
+	nc := natsConn.NatsConn()
+	if nc == nil || !nc.IsConnected() {
+		return dependencyStatus(start, errors.New("соединение закрыто"))
+	}
+	if _, err := nc.RTT(); err != nil {
+		return dependencyStatus(start, err)
+	}
+	return dependencyStatus(start, nil)
+}
+
+func dependencyStatus(start time.Time, err error) DependencyStatus {
+	s := DependencyStatus{
+		OK:        err == nil,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	return s
+}
+
+func collectStatus(ctx context.Context) ServiceStatus {
+	s := ServiceStatus{
+		ShuttingDown: shuttingDown.Load(),
+		StartedAt:    startedAt,
+		Uptime:       time.Since(startedAt).Round(time.Second).String(),
+		Postgres:     checkPostgres(ctx),
+		NATS:         checkNATS(),
+		CacheWarmed:  cacheWarmed.Load(),
+	}
+	if cache != nil {
+		s.Cache = cache.Stats()
+	}
+	if ns := lastMessageAt.Load(); ns != 0 {
+		t := time.Unix(0, ns)
+		s.LastMessageAt = &t
+	}
+	s.Ready = !s.ShuttingDown && s.Postgres.OK && s.NATS.OK && s.CacheWarmed
+	return s
+}
+
+// GET /healthz — процесс жив и отвечает
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// GET /readyz — БД и NATS доступны, кэш восстановлен, сервис не останавливается
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	s := collectStatus(ctx)
+	checks := map[string]bool{
+		"postgres":     s.Postgres.OK,
+		"nats":         s.NATS.OK,
+		"cache_warmed": s.CacheWarmed,
+		"running":      !s.ShuttingDown,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !s.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"ready": s.Ready, "checks": checks})
+}
+
+// GET /status — подробное состояние зависимостей, кэша и приёма сообщений
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collectStatus(ctx))
+}
@@ -0,0 +1,321 @@
+// history.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// OrderVersion — одна версия заказа в хронологии изменений
+type OrderVersion struct {
+	Version   int           `json:"version"`
+	NatsSeq   uint64        `json:"nats_seq"`
+	ValidFrom time.Time     `json:"valid_from"` // когда версия была записана
+	Current   bool          `json:"current"`
+	Changes   []FieldChange `json:"changes,omitempty"` // отличия от предыдущей версии
+	Order     Order         `json:"order"`
+}
+
+// FieldChange — изменение одного поля; Field — путь в JSON, например "items[0].price"
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// Служебные поля, которые не считаются изменением заказа
+var diffIgnoredFields = map[string]bool{
+	"id":           true,
+	"version":      true,
+	"nats_seq":     true,
+	"message_time": true,
+	"created_at":   true,
+	"updated_at":   true,
+	"order_uid":    true,
+}
+
+// lockOrderUIDSQL берёт транзакционную advisory-блокировку order_uid. В отличие от
+// FOR UPDATE она работает и для заказа, которого ещё нет: две первые версии одного
+// заказа не вставляются параллельно мимо проверок версии и порядка.
+const lockOrderUIDSQL = `SELECT pg_advisory_xact_lock(hashtext($1))`
+
+// lockOrderTx блокирует order_uid до конца транзакции, чтобы версии не перемешались,
+// и читает текущее состояние заказа вместе с позициями; found = false, если заказа ещё нет
+func lockOrderTx(ctx context.Context, tx *sql.Tx, uid string) (current Order, found bool, err error) {
+	advisoryCtx, advisorySpan := startSQLSpan(ctx, "ADVISORY LOCK", "orders")
+	_, err = tx.ExecContext(advisoryCtx, lockOrderUIDSQL, uid)
+	endSpan(advisorySpan, err)
+	if err != nil {
+		return current, false, err
+	}
+
+	lockCtx, lockSpan := startSQLSpan(ctx, "SELECT FOR UPDATE", "orders")
+	current, err = scanOrder(tx.QueryRowContext(lockCtx, `SELECT `+orderColumns+` FROM orders WHERE order_uid = $1 FOR UPDATE`, uid))
+	if errors.Is(err, sql.ErrNoRows) {
+		endSpan(lockSpan, nil)
+		return current, false, nil
+	}
+	endSpan(lockSpan, err)
+	if err != nil {
+		return current, false, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+itemColumns+` FROM order_items WHERE order_uid = $1 ORDER BY id`, uid)
+	if err != nil {
+		return current, false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item, err := scanItem(rows)
+		if err != nil {
+			return current, false, err
+		}
+		current.Items = append(current.Items, item)
+	}
+	return current, true, rows.Err()
+}
+
+// saveVersionTx сохраняет состояние заказа, прочитанное lockOrderTx, в order_versions перед его обновлением
+func saveVersionTx(ctx context.Context, tx *sql.Tx, current Order) error {
+	snapshot, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+
+	insertCtx, insertSpan := startSQLSpan(ctx, "INSERT", "order_versions")
+	_, err = tx.ExecContext(insertCtx, `
+		INSERT INTO order_versions (order_uid, version, nats_seq, snapshot, valid_from)
+		VALUES ($1, $2, $3, $4, $5)
+	`, current.OrderUID, current.Version, int64(current.NatsSeq), snapshot, current.UpdatedAt)
+	endSpan(insertSpan, err)
+	return err
+}
+
+// loadOrderHistory возвращает все версии заказа от первой к текущей; nil, если заказа нет
+func loadOrderHistory(ctx context.Context, uid string) ([]OrderVersion, error) {
+	current, found, err := loadOrderFromDB(ctx, uid)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	rows, err := DB.QueryContext(ctx, `
+		SELECT version, nats_seq, snapshot, valid_from
+		FROM order_versions
+		WHERE order_uid = $1
+		ORDER BY version
+	`, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []OrderVersion
+	for rows.Next() {
+		var v OrderVersion
+		var seq int64
+		var snapshot []byte
+		if err := rows.Scan(&v.Version, &seq, &snapshot, &v.ValidFrom); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(snapshot, &v.Order); err != nil {
+			return nil, fmt.Errorf("снимок версии %d: %w", v.Version, err)
+		}
+		v.NatsSeq = uint64(seq)
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	versions = append(versions, OrderVersion{
+		Version:   current.Version,
+		NatsSeq:   current.NatsSeq,
+		ValidFrom: current.UpdatedAt,
+		Current:   true,
+		Order:     current,
+	})
+
+	for i := 1; i < len(versions); i++ {
+		changes, err := diffOrders(versions[i-1].Order, versions[i].Order)
+		if err != nil {
+			return nil, err
+		}
+		versions[i].Changes = changes
+	}
+	return versions, nil
+}
+
+// diffOrders сравнивает две версии заказа по всем полям JSON, включая позиции
+func diffOrders(old, new Order) ([]FieldChange, error) {
+	oldFields, err := flattenOrder(old)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := flattenOrder(new)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool, len(oldFields))
+	for k := range oldFields {
+		keys[k] = true
+	}
+	for k := range newFields {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var changes []FieldChange
+	for _, k := range sorted {
+		o, n := oldFields[k], newFields[k]
+		if !reflect.DeepEqual(o, n) {
+			changes = append(changes, FieldChange{Field: k, Old: o, New: n})
+		}
+	}
+	return changes, nil
+}
+
+// flattenOrder превращает заказ в набор "путь → значение" без служебных полей
+func flattenOrder(o Order) (map[string]interface{}, error) {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	var tree interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]interface{})
+	flatten("", tree, out)
+	return out, nil
+}
+
+func flatten(prefix string, v interface{}, out map[string]interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if diffIgnoredFields[k] {
+				continue
+			}
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flatten(key, child, out)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flatten(fmt.Sprintf("%s[%d]", prefix, i), child, out)
+		}
+	default:
+		out[prefix] = v
+	}
+}
+
+// GET /api/order/{uid}/history — хронология версий заказа
+func apiOrderHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	uid := mux.Vars(r)["uid"]
+
+	versions, err := loadOrderHistory(r.Context(), uid)
+	if err != nil {
+		logFromContext(r.Context()).Error("Ошибка чтения истории заказа", logKeyOrderUID, uid, errAttr(err))
+		http.Error(w, "Ошибка чтения из БД", http.StatusInternalServerError)
+		return
+	}
+	if versions == nil {
+		http.Error(w, "Заказ не найден", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// Страница с хронологией изменений заказа
+func orderHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	uid := mux.Vars(r)["uid"]
+
+	versions, err := loadOrderHistory(r.Context(), uid)
+	if err != nil {
+		logFromContext(r.Context()).Error("Ошибка чтения истории заказа", logKeyOrderUID, uid, errAttr(err))
+		http.Error(w, "Ошибка чтения из БД", http.StatusInternalServerError)
+		return
+	}
+	if versions == nil {
+		http.Error(w, "Заказ не найден", http.StatusNotFound)
+		return
+	}
+
+	// Новые версии показываем первыми
+	for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+		versions[i], versions[j] = versions[j], versions[i]
+	}
+
+	data := struct {
+		OrderUID string
+		Versions []OrderVersion
+	}{
+		OrderUID: uid,
+		Versions: versions,
+	}
+
+	tmpl := `
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>История заказа {{.OrderUID}}</title>
+	<style>
+		body { font-family: Arial, sans-serif; margin: 20px; }
+		.version { margin: 15px 0; padding: 10px; border: 1px solid #ddd; }
+		.version.current { border-color: #27ae60; }
+		table { border-collapse: collapse; width: 100%; margin-top: 10px; }
+		th, td { border: 1px solid #ddd; padding: 6px; text-align: left; }
+		th { background-color: #f2f2f2; }
+		a { color: #0066cc; }
+	</style>
+</head>
+<body>
+	<h1>История заказа {{.OrderUID}}</h1>
+	{{range .Versions}}
+	<div class="version{{if .Current}} current{{end}}">
+		<strong>Версия {{.Version}}</strong>{{if .Current}} (текущая){{end}} ·
+		{{.ValidFrom.Format "2006-01-02 15:04:05"}} ·
+		NATS seq {{.NatsSeq}}
+		{{if .Changes}}
+		<table>
+			<tr><th>Поле</th><th>Было</th><th>Стало</th></tr>
+			{{range .Changes}}
+			<tr><td>{{.Field}}</td><td>{{.Old}}</td><td>{{.New}}</td></tr>
+			{{end}}
+		</table>
+		{{else if eq .Version 1}}
+		<p>Заказ создан</p>
+		{{else}}
+		<p>Без изменений полей</p>
+		{{end}}
+	</div>
+	{{end}}
+	<a href="/order/{{.OrderUID}}">← Назад к заказу</a>
+</body>
+</html>
+`
+
+	t, _ := template.New("history").Parse(tmpl)
+	t.Execute(w, data)
+}
@@ -0,0 +1,90 @@
+// history_test.go
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffOrders(t *testing.T) {
+	t0 := time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)
+	base := func() Order {
+		return Order{
+			ID:            1,
+			OrderUID:      "b563feb7b2b84b6test",
+			TrackNumber:   "WBILMTESTTRACK",
+			PaymentAmount: 1817,
+			DeliveryCity:  "Kiryat Mozkin",
+			DateCreated:   t0,
+			Version:       1,
+			NatsSeq:       10,
+			CreatedAt:     t0,
+			UpdatedAt:     t0,
+			Items: []Item{
+				{ID: 1, OrderUID: "b563feb7b2b84b6test", ChrtID: 9934930, Price: 453, Name: "Mascaras", CreatedAt: t0},
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(o *Order)
+		want   []FieldChange
+	}{
+		{"same order", func(o *Order) {}, nil},
+		{"service fields ignored", func(o *Order) {
+			next := t0.Add(time.Hour)
+			o.ID, o.Version, o.NatsSeq = 2, 2, 11
+			o.MessageTime, o.CreatedAt, o.UpdatedAt = &next, next, next
+			o.Items[0].ID, o.Items[0].CreatedAt = 5, next
+		}, nil},
+		{"top-level field", func(o *Order) { o.DeliveryCity = "Moscow" },
+			[]FieldChange{{Field: "delivery_city", Old: "Kiryat Mozkin", New: "Moscow"}}},
+		{"number field", func(o *Order) { o.PaymentAmount = 1818 },
+			[]FieldChange{{Field: "payment_amount", Old: float64(1817), New: float64(1818)}}},
+		{"item field", func(o *Order) { o.Items[0].Price = 500 },
+			[]FieldChange{{Field: "items[0].price", Old: float64(453), New: float64(500)}}},
+		{"sorted by field", func(o *Order) {
+			o.TrackNumber = "NEW"
+			o.DeliveryCity = "Moscow"
+		}, []FieldChange{
+			{Field: "delivery_city", Old: "Kiryat Mozkin", New: "Moscow"},
+			{Field: "track_number", Old: "WBILMTESTTRACK", New: "NEW"},
+		}},
+		{"item added", func(o *Order) {
+			o.Items = append(o.Items, Item{ChrtID: 1, Name: "Brush"})
+		}, []FieldChange{
+			{Field: "items[1].brand", New: ""},
+			{Field: "items[1].chrt_id", New: float64(1)},
+			{Field: "items[1].name", New: "Brush"},
+			{Field: "items[1].nm_id", New: float64(0)},
+			{Field: "items[1].price", New: float64(0)},
+			{Field: "items[1].rid", New: ""},
+			{Field: "items[1].sale", New: float64(0)},
+			{Field: "items[1].size", New: ""},
+			{Field: "items[1].status", New: float64(0)},
+			{Field: "items[1].total_price", New: float64(0)},
+			{Field: "items[1].track_number", New: ""},
+		}},
+		{"flag reasons added", func(o *Order) { o.FlagReasons = []string{"amount"} },
+			[]FieldChange{{Field: "flag_reasons[0]", New: "amount"}}},
+		// Один и тот же момент в другом поясе сериализуется иначе и считается изменением
+		{"time zone differs", func(o *Order) { o.DateCreated = t0.In(time.FixedZone("MSK", 3*60*60)) },
+			[]FieldChange{{Field: "date_created", Old: "2021-11-26T06:22:19Z", New: "2021-11-26T09:22:19+03:00"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, updated := base(), base()
+			tt.modify(&updated)
+
+			got, err := diffOrders(old, updated)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("diffOrders() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
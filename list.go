@@ -0,0 +1,205 @@
+// list.go
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OrderFilter — условия отбора заказов для списка и API
+type OrderFilter struct {
+	DateFrom        time.Time // включительно
+	DateTo          time.Time // не включительно
+	DeliveryService string
+	Currency        string
+	City            string
+	ItemStatus      *int // есть хотя бы одна позиция с этим статусом
+	CustomerID      string
+	TrackNumber     string
+	AmountMin       *int
+	AmountMax       *int
+}
+
+// where строит условие WHERE с параметрами, начиная с $1
+func (f OrderFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if !f.DateFrom.IsZero() {
+		add("date_created >= $%d", f.DateFrom)
+	}
+	if !f.DateTo.IsZero() {
+		add("date_created < $%d", f.DateTo)
+	}
+	if f.DeliveryService != "" {
+		add("delivery_service = $%d", f.DeliveryService)
+	}
+	if f.Currency != "" {
+		add("payment_currency = $%d", f.Currency)
+	}
+	if f.City != "" {
+		add("delivery_city = $%d", f.City)
+	}
+	if f.ItemStatus != nil {
+		add("EXISTS (SELECT 1 FROM order_items i WHERE i.order_uid = orders.order_uid AND i.status = $%d)", *f.ItemStatus)
+	}
+	if f.CustomerID != "" {
+		add("customer_id = $%d", f.CustomerID)
+	}
+	if f.TrackNumber != "" {
+		add("track_number = $%d", f.TrackNumber)
+	}
+	if f.AmountMin != nil {
+		add("payment_amount >= $%d", *f.AmountMin)
+	}
+	if f.AmountMax != nil {
+		add("payment_amount <= $%d", *f.AmountMax)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// Сортировки списка заказов: значение параметра sort → колонка
+var listSortColumns = map[string]string{
+	"date":     "date_created",
+	"amount":   "payment_amount",
+	"city":     "delivery_city",
+	"customer": "delivery_name",
+}
+
+// Параметры страницы списка заказов
+type listParams struct {
+	Filter  OrderFilter
+	Sort    string
+	Desc    bool
+	Page    int
+	PerPage int
+}
+
+const (
+	listDefaultPerPage = 50
+	listMaxPerPage     = 500
+)
+
+// parseListParams разбирает параметры списка из URL; ошибки — некорректные значения фильтров
+func parseListParams(q url.Values) (listParams, error) {
+	p := listParams{Sort: "date", Desc: true, Page: 1, PerPage: listDefaultPerPage}
+
+	if v := q.Get("sort"); v != "" {
+		if _, ok := listSortColumns[v]; !ok {
+			return p, fmt.Errorf("неизвестная сортировка %q", v)
+		}
+		p.Sort = v
+	}
+	if v := q.Get("dir"); v != "" {
+		if v != "asc" && v != "desc" {
+			return p, fmt.Errorf("направление сортировки должно быть asc или desc")
+		}
+		p.Desc = v == "desc"
+	}
+	if v := q.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return p, fmt.Errorf("некорректный номер страницы %q", v)
+		}
+		p.Page = n
+	}
+	if v := q.Get("per_page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > listMaxPerPage {
+			return p, fmt.Errorf("per_page должен быть от 1 до %d", listMaxPerPage)
+		}
+		p.PerPage = n
+	}
+
+	if v := q.Get("date_from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return p, fmt.Errorf("некорректная дата date_from %q", v)
+		}
+		p.Filter.DateFrom = t
+	}
+	if v := q.Get("date_to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return p, fmt.Errorf("некорректная дата date_to %q", v)
+		}
+		p.Filter.DateTo = t.AddDate(0, 0, 1) // включая весь день date_to
+	}
+	p.Filter.DeliveryService = strings.TrimSpace(q.Get("delivery_service"))
+	p.Filter.Currency = strings.ToUpper(strings.TrimSpace(q.Get("currency")))
+	p.Filter.City = strings.TrimSpace(q.Get("city"))
+	if v := q.Get("item_status"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return p, fmt.Errorf("некорректный статус позиции %q", v)
+		}
+		p.Filter.ItemStatus = &n
+	}
+
+	return p, nil
+}
+
+// listOrdersPage возвращает страницу заказов (без позиций) и общее число заказов по фильтру.
+// Порядок стабилен: при равных значениях сортировки заказы упорядочены по id.
+func listOrdersPage(p listParams) ([]Order, int, error) {
+	where, args := p.Filter.where()
+
+	var total int
+	if err := DB.QueryRow(`SELECT count(*) FROM orders`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	dir := "ASC"
+	if p.Desc {
+		dir = "DESC"
+	}
+	query := fmt.Sprintf(`SELECT %s FROM orders%s ORDER BY %s %s, id %s LIMIT $%d OFFSET $%d`,
+		orderColumns, where, listSortColumns[p.Sort], dir, dir, len(args)+1, len(args)+2)
+	args = append(args, p.PerPage, (p.Page-1)*p.PerPage)
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	orders := []Order{}
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, total, rows.Err()
+}
+
+// listURL возвращает ссылку на список с текущими параметрами, заменив указанные
+func listURL(q url.Values, overrides ...string) string {
+	v := url.Values{}
+	for key, values := range q {
+		v[key] = append([]string(nil), values...)
+	}
+	for i := 0; i+1 < len(overrides); i += 2 {
+		if overrides[i+1] == "" {
+			v.Del(overrides[i])
+		} else {
+			v.Set(overrides[i], overrides[i+1])
+		}
+	}
+	if len(v) == 0 {
+		return "/"
+	}
+	return "/?" + v.Encode()
+}
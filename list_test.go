@@ -0,0 +1,158 @@
+// list_test.go
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseListParams(t *testing.T) {
+	status := 202
+	defaults := listParams{Sort: "date", Desc: true, Page: 1, PerPage: listDefaultPerPage}
+	with := func(modify func(p *listParams)) listParams {
+		p := defaults
+		modify(&p)
+		return p
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    listParams
+		wantErr bool
+	}{
+		{"defaults", "", defaults, false},
+		{"sort and dir", "sort=amount&dir=asc", with(func(p *listParams) { p.Sort, p.Desc = "amount", false }), false},
+		{"sort by customer", "sort=customer", with(func(p *listParams) { p.Sort = "customer" }), false},
+		{"unknown sort", "sort=id", listParams{}, true},
+		{"sql in sort", "sort=date_created%3BDROP+TABLE+orders", listParams{}, true},
+		{"bad dir", "dir=up", listParams{}, true},
+		{"page", "page=3&per_page=20", with(func(p *listParams) { p.Page, p.PerPage = 3, 20 }), false},
+		{"zero page", "page=0", listParams{}, true},
+		{"page not a number", "page=two", listParams{}, true},
+		{"per_page at max", "per_page=500", with(func(p *listParams) { p.PerPage = listMaxPerPage }), false},
+		{"per_page above max", "per_page=501", listParams{}, true},
+		{"zero per_page", "per_page=0", listParams{}, true},
+		{"dates", "date_from=2021-11-01&date_to=2021-11-26", with(func(p *listParams) {
+			p.Filter.DateFrom = time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+			// date_to включается целиком
+			p.Filter.DateTo = time.Date(2021, 11, 27, 0, 0, 0, 0, time.UTC)
+		}), false},
+		{"date_to at month end", "date_to=2021-11-30", with(func(p *listParams) {
+			p.Filter.DateTo = time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+		}), false},
+		{"date_from with time", "date_from=2021-11-01T00:00:00Z", listParams{}, true},
+		{"bad date_to", "date_to=26.11.2021", listParams{}, true},
+		{"impossible date", "date_from=2021-02-30", listParams{}, true},
+		{"filters normalized", "delivery_service=+meest+&currency=usd&city=Kiryat+Mozkin&item_status=202", with(func(p *listParams) {
+			p.Filter.DeliveryService, p.Filter.Currency, p.Filter.City = "meest", "USD", "Kiryat Mozkin"
+			p.Filter.ItemStatus = &status
+		}), false},
+		{"bad item_status", "item_status=done", listParams{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseListParams(q)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ожидалась ошибка, получено %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ошибка: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		overrides []string
+		want      string
+	}{
+		{"empty", "", nil, "/"},
+		{"kept", "sort=amount&dir=asc", nil, "/?dir=asc&sort=amount"},
+		{"replaced", "page=2&sort=amount", []string{"page", "3"}, "/?page=3&sort=amount"},
+		{"added", "sort=amount", []string{"page", "2"}, "/?page=2&sort=amount"},
+		{"removed", "page=2&sort=amount", []string{"page", ""}, "/?sort=amount"},
+		{"all removed", "page=2", []string{"page", ""}, "/"},
+		{"escaped", "city=Kiryat+Mozkin&date_to=2021-11-26", nil, "/?city=Kiryat+Mozkin&date_to=2021-11-26"},
+		{"odd override ignored", "page=2", []string{"page"}, "/?page=2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, _ := url.ParseQuery(tt.query)
+			if got := listURL(q, tt.overrides...); got != tt.want {
+				t.Fatalf("listURL() = %q, want %q", got, tt.want)
+			}
+			if len(tt.overrides) == 0 && q.Encode() != "" {
+				// Ссылка без замен разбирается в те же параметры
+				u, err := url.Parse(listURL(q))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(u.Query(), q) {
+					t.Fatalf("после разбора %v, ожидалось %v", u.Query(), q)
+				}
+			}
+		})
+	}
+
+	t.Run("source not modified", func(t *testing.T) {
+		q := url.Values{"page": {"2"}}
+		listURL(q, "page", "3")
+		if q.Get("page") != "2" {
+			t.Fatalf("listURL изменил исходные параметры: %v", q)
+		}
+	})
+}
+
+func TestOrderFilterWhere(t *testing.T) {
+	status, low, high := 202, 100, 5000
+	from := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2021, 11, 27, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		filter    OrderFilter
+		wantWhere string
+		wantArgs  []interface{}
+	}{
+		{"empty", OrderFilter{}, "", nil},
+		{"one", OrderFilter{Currency: "USD"}, " WHERE payment_currency = $1", []interface{}{"USD"}},
+		{"skipped fields keep numbering", OrderFilter{DateTo: to, City: "Kiryat Mozkin", AmountMax: &high},
+			" WHERE date_created < $1 AND delivery_city = $2 AND payment_amount <= $3",
+			[]interface{}{to, "Kiryat Mozkin", high}},
+		{"all", OrderFilter{
+			DateFrom: from, DateTo: to, DeliveryService: "meest", Currency: "USD", City: "Kiryat Mozkin",
+			ItemStatus: &status, CustomerID: "test", TrackNumber: "WBILMTESTTRACK", AmountMin: &low, AmountMax: &high,
+		}, " WHERE date_created >= $1 AND date_created < $2 AND delivery_service = $3 AND payment_currency = $4" +
+			" AND delivery_city = $5" +
+			" AND EXISTS (SELECT 1 FROM order_items i WHERE i.order_uid = orders.order_uid AND i.status = $6)" +
+			" AND customer_id = $7 AND track_number = $8 AND payment_amount >= $9 AND payment_amount <= $10",
+			[]interface{}{from, to, "meest", "USD", "Kiryat Mozkin", status, "test", "WBILMTESTTRACK", low, high}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := tt.filter.where()
+			if where != tt.wantWhere {
+				t.Fatalf("where = %q\nwant    %q", where, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Fatalf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+// load.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyTracker опрашивает /api/order/{uid} до появления заказов и собирает задержки.
+// Опросом занимается одна горутина: раз в interval она проверяет заказы, срок проверки
+// которых подошёл, не больше concurrency запросов одновременно. Пауза между проверками
+// одного заказа растёт вдвое от interval до maxInterval, поэтому задержка измеряется
+// с точностью до текущей паузы.
+type latencyTracker struct {
+	api         string
+	client      *http.Client
+	timeout     time.Duration
+	interval    time.Duration
+	maxInterval time.Duration
+	concurrency int
+
+	mu        sync.Mutex
+	pending   []*trackedOrder
+	closed    bool
+	latencies []time.Duration
+	missing   int
+	done      chan struct{}
+}
+
+// trackedOrder — заказ, появления которого в API ждёт latencyTracker
+type trackedOrder struct {
+	uid      string
+	sentAt   time.Time
+	deadline time.Time
+	next     time.Time     // время следующей проверки
+	wait     time.Duration // текущая пауза между проверками
+	found    bool
+}
+
+func newLatencyTracker(api string, timeout, interval, maxInterval time.Duration, concurrency int) *latencyTracker {
+	t := &latencyTracker{
+		api:         strings.TrimRight(api, "/"),
+		client:      &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{MaxIdleConnsPerHost: concurrency}},
+		timeout:     timeout,
+		interval:    interval,
+		maxInterval: max(maxInterval, interval),
+		concurrency: concurrency,
+		done:        make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Track начинает ожидание заказа, публикация которого началась в момент sentAt
+func (t *latencyTracker) Track(uid string, sentAt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = append(t.pending, &trackedOrder{
+		uid:      uid,
+		sentAt:   sentAt,
+		deadline: sentAt.Add(t.timeout),
+		next:     time.Now(),
+		wait:     t.interval,
+	})
+}
+
+// run раз в interval проверяет заказы, срок проверки которых подошёл, пока после Wait
+// не останется ни одного ожидаемого заказа
+func (t *latencyTracker) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		var due []*trackedOrder
+		t.mu.Lock()
+		pending := t.pending[:0]
+		for _, o := range t.pending {
+			switch {
+			case o.found:
+			case now.After(o.deadline):
+				t.missing++
+			case now.Before(o.next):
+				pending = append(pending, o)
+			default:
+				pending = append(pending, o)
+				due = append(due, o)
+			}
+		}
+		clear(t.pending[len(pending):])
+		t.pending = pending
+		finished := t.closed && len(pending) == 0
+		t.mu.Unlock()
+
+		if finished {
+			return
+		}
+		t.check(due)
+	}
+}
+
+// check проверяет заказы не больше чем concurrency запросами одновременно
+func (t *latencyTracker) check(orders []*trackedOrder) {
+	sem := make(chan struct{}, t.concurrency)
+	var wg sync.WaitGroup
+	for _, o := range orders {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			if !t.exists(o.uid) {
+				o.wait = min(o.wait*2, t.maxInterval)
+				o.next = time.Now().Add(o.wait)
+				return
+			}
+			o.found = true
+			t.mu.Lock()
+			t.latencies = append(t.latencies, time.Since(o.sentAt))
+			t.mu.Unlock()
+		}()
+	}
+	wg.Wait()
+}
+
+// exists — заказ уже отдаётся API
+func (t *latencyTracker) exists(uid string) bool {
+	resp, err := t.client.Get(t.api + "/api/order/" + url.PathEscape(uid))
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// LoadReport — итог нагрузочного теста; задержки в миллисекундах, Rate — сообщений в секунду
+type LoadReport struct {
+	Published int
+	Failed    int
+	Found     int
+	Missing   int
+	Rate      float64
+	P50       float64
+	P90       float64
+	P99       float64
+	Max       float64
+}
+
+// Wait дожидается всех заказов и считает перцентили задержки
+func (t *latencyTracker) Wait() LoadReport {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	<-t.done
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	slices.Sort(t.latencies)
+	report := LoadReport{Found: len(t.latencies), Missing: t.missing}
+	percentile := func(p float64) float64 {
+		if len(t.latencies) == 0 {
+			return 0
+		}
+		i := int(math.Ceil(p*float64(len(t.latencies)))) - 1
+		return float64(t.latencies[max(i, 0)].Microseconds()) / 1000
+	}
+	report.P50, report.P90, report.P99, report.Max = percentile(0.5), percentile(0.9), percentile(0.99), percentile(1)
+	return report
+}
+
+// runLoadCommand — go run . load [флаги]: публикует сгенерированные заказы с заданной
+// скоростью в течение заданного времени, затем ждёт появления каждого заказа в
+// /api/order/{uid} и выводит задержку от начала публикации (включая ожидание
+// подтверждения NATS Streaming) до появления в API
+func runLoadCommand(args []string) error {
+	var opts publishOptions
+	fs := flag.NewFlagSet("load", flag.ExitOnError)
+	opts.register(fs, 10)
+	duration := fs.Duration("duration", 10*time.Second, "длительность публикации")
+	seed := fs.Uint64("seed", 0, "начальное значение генератора, 0 — случайное")
+	maxItems := fs.Int("max-items", 5, "максимум позиций в заказе")
+	api := fs.String("api", defaultAPIURL(), "адрес веб-сервера сервиса")
+	timeout := fs.Duration("timeout", 30*time.Second, "сколько ждать появления каждого заказа")
+	interval := fs.Duration("poll-interval", 50*time.Millisecond, "начальный интервал опроса заказа")
+	maxInterval := fs.Duration("poll-max-interval", time.Second, "максимальный интервал опроса заказа")
+	concurrency := fs.Int("poll-concurrency", 16, "максимум одновременных запросов к API")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.rate <= 0 {
+		return errors.New("-rate: должно быть больше 0")
+	}
+	if *interval <= 0 || *concurrency <= 0 {
+		return errors.New("-poll-interval и -poll-concurrency: должны быть больше 0")
+	}
+
+	p, err := newPublisher(opts)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	gen := newOrderGenerator(*seed, *maxItems)
+	tracker := newLatencyTracker(*api, *timeout, *interval, *maxInterval, *concurrency)
+
+	slog.Info("Нагрузочный тест", "rate", opts.rate, "duration", duration.String(), "api", *api)
+	start := time.Now()
+	for time.Since(start) < *duration {
+		// Дата заказа — текущая, чтобы новые заказы были вверху списка
+		order := gen.Next()
+		order.DateCreated = time.Now().UTC().Format(time.RFC3339)
+		data, err := json.Marshal(order)
+		if err != nil {
+			return err
+		}
+		sentAt := time.Now()
+		if p.publish("generator", data) {
+			tracker.Track(order.OrderUID, sentAt)
+		}
+	}
+	elapsed := time.Since(start)
+
+	slog.Info("Публикация завершена, ожидание заказов в API", "published", p.summary.Published)
+	report := tracker.Wait()
+	report.Published, report.Failed = p.summary.Published, p.summary.Failed
+	report.Rate = math.Round(float64(report.Published)/elapsed.Seconds()*10) / 10
+
+	slog.Info("Итог нагрузочного теста",
+		"published", report.Published,
+		"failed", report.Failed,
+		"found", report.Found,
+		"missing", report.Missing,
+		"rate", report.Rate,
+		"p50_ms", report.P50,
+		"p90_ms", report.P90,
+		"p99_ms", report.P99,
+		"max_ms", report.Max,
+	)
+	if report.Failed > 0 || report.Missing > 0 {
+		return fmt.Errorf("не отправлено %d, не появилось в API %d заказов", report.Failed, report.Missing)
+	}
+	return nil
+}
+
+// defaultAPIURL — адрес веб-сервера из http.addr; ":8080" превращается в http://localhost:8080
+func defaultAPIURL() string {
+	addr := cfg.HTTP.Addr
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	return "http://" + addr
+}
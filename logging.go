@@ -0,0 +1,143 @@
+// logging.go
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Форматы логов
+const (
+	logFormatJSON = "json"
+	logFormatText = "text"
+)
+
+// Стандартные поля логов; одинаковые имена во всех файлах, чтобы по ним можно было фильтровать
+const (
+	logKeyOrderUID  = "order_uid"
+	logKeyNatsSeq   = "nats_seq"
+	logKeyRequestID = "request_id"
+	logKeyDuration  = "duration_ms"
+	logKeyTraceID   = "trace_id"
+	logKeyError     = "error"
+)
+
+// requestIDHeader — заголовок, в котором клиент может передать свой идентификатор запроса
+const requestIDHeader = "X-Request-ID"
+
+// initLogger настраивает slog по cfg.Log. Стандартный log после этого тоже пишет через slog.
+func initLogger() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Log.Level)); err != nil {
+		level = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if cfg.Log.Format == logFormatText {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// fatal пишет ошибку и завершает процесс, как log.Fatal
+func fatal(msg string, err error) {
+	slog.Error(msg, errAttr(err))
+	os.Exit(1)
+}
+
+func errAttr(err error) slog.Attr {
+	return slog.Any(logKeyError, err)
+}
+
+func durationAttr(d time.Duration) slog.Attr {
+	return slog.Float64(logKeyDuration, float64(d.Microseconds())/1000)
+}
+
+type requestIDKey struct{}
+
+// requestIDFromContext возвращает идентификатор HTTP-запроса или пустую строку
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logFromContext возвращает логгер с request_id и trace_id из контекста, если они есть
+func logFromContext(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	if id := requestIDFromContext(ctx); id != "" {
+		logger = logger.With(logKeyRequestID, id)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		logger = logger.With(logKeyTraceID, sc.TraceID().String())
+	}
+	return logger
+}
+
+// newRequestID генерирует случайный идентификатор из 16 hex-символов
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID принимает идентификатор клиента, только если он короткий и печатный
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	return !strings.ContainsFunc(id, func(r rune) bool { return r < 0x21 || r > 0x7e })
+}
+
+// requestLogMiddleware присваивает запросу идентификатор (или берёт его из X-Request-ID),
+// возвращает его в ответе и пишет строку лога по завершении запроса
+func requestLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		// Пробы и сбор метрик вызываются постоянно, их пишем только на уровне debug
+		level := slog.LevelInfo
+		route := r.URL.Path
+		if cur := mux.CurrentRoute(r); cur != nil {
+			if tpl, err := cur.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		switch route {
+		case "/healthz", "/readyz", "/metrics":
+			level = slog.LevelDebug
+		}
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		slog.LogAttrs(ctx, level, "HTTP-запрос",
+			slog.String(logKeyRequestID, id),
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			durationAttr(time.Since(start)),
+		)
+	})
+}
@@ -2,12 +2,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"log"
-	"sync"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/nats-io/stan.go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 
@@ -26,6 +32,7 @@ type OrderJSON struct {
 	SmID              int       `json:"sm_id"`
 	DateCreated       string    `json:"date_created"` // ISO 8601 строка
 	OofShard          string    `json:"oof_shard"`
+	ProducerVersion   int64     `json:"producer_version,omitempty"` // версия заказа у производителя, растёт с каждым обновлением
 }
 
 type Delivery struct {
@@ -65,101 +72,401 @@ type ItemJSON struct {
 	Status      int    `json:"status"`
 }
 
-// Глобальный кэш (должен быть доступен в web.go)
-var cache = make(map[string]Order)
-var cacheMutex sync.RWMutex
+// toolCommands — подкоманды публикатора и нагрузочного теста
+var toolCommands = map[string]func(args []string) error{
+	"publish":  runPublishCommand,
+	"generate": runGenerateCommand,
+	"load":     runLoadCommand,
+}
 
-func main() {
-	initDB()
-	restoreCacheFromDB()
+// Глобальный кэш (должен быть доступен в web.go); промахи дочитываются из БД
+var cache *OrderCache
 
-	sc, err := stan.Connect("test-cluster", "order-service", stan.NatsURL("nats://localhost:4222"))
+// Подключение к NATS Streaming (используется для публикации в DLQ и повторной отправки)
+var natsConn stan.Conn
+
+func main() {
+	var args []string
+	var err error
+	cfg, args, err = loadConfig("order-service", os.Args[1:])
 	if err != nil {
-		log.Fatal("Не удалось подключиться к NATS Streaming:", err)
+		fatal("Некорректная конфигурация", err)
 	}
-	defer sc.Close()
-
-	log.Println("Подключен к NATS Streaming")
+	initLogger()
 
-	_, err = sc.Subscribe("orders", func(msg *stan.Msg) {
-		var msgJSON OrderJSON
-		if err := json.Unmarshal(msg.Data, &msgJSON); err != nil {
-			log.Printf("Ошибка разбора JSON: %v", err)
+	// Команды для тестирования, которым не нужна БД:
+	// go run . [флаги] publish file|dir|ndjson ... | generate ... | load ...
+	// Запускаются до проверки конфигурации сервиса: им нужны только свои флаги.
+	if len(args) > 0 {
+		if run, ok := toolCommands[args[0]]; ok {
+			shutdownTracing, err := initTracing(context.Background())
+			if err != nil {
+				fatal("Ошибка настройки трассировки", err)
+			}
+			err = run(args[1:])
+			if err := shutdownTracing(context.Background()); err != nil {
+				slog.Warn("Ошибка выгрузки трасс", errAttr(err))
+			}
+			if err != nil {
+				fatal("Ошибка команды "+args[0], err)
+			}
 			return
 		}
+	}
 
-		if msgJSON.OrderUID == "" {
-			log.Println("order_uid отсутствует в сообщении")
-			return
+	if err := cfg.validate(); err != nil {
+		fatal("Некорректная конфигурация", err)
+	}
+
+	cfg.logConfig()
+
+	initDB()
+
+	// Отдельная команда: go run . [флаги] migrate up | down [N] | status
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrateCommand(args[1:]); err != nil {
+			fatal("Ошибка миграции", err)
 		}
+		return
+	}
 
-		order := Order{
-			OrderUID:          msgJSON.OrderUID,
-			TrackNumber:       msgJSON.TrackNumber,
-			Entry:             msgJSON.Entry,
-			DeliveryName:      msgJSON.Delivery.Name,
-			DeliveryPhone:     msgJSON.Delivery.Phone,
-			DeliveryZip:       msgJSON.Delivery.Zip,
-			DeliveryCity:      msgJSON.Delivery.City,
-			DeliveryAddress:   msgJSON.Delivery.Address,
-			DeliveryRegion:    msgJSON.Delivery.Region,
-			DeliveryEmail:     msgJSON.Delivery.Email,
-			PaymentTransaction: msgJSON.Payment.Transaction,
-			PaymentRequestID:  msgJSON.Payment.RequestID,
-			PaymentCurrency:   msgJSON.Payment.Currency,
-			PaymentProvider:   msgJSON.Payment.Provider,
-			PaymentAmount:     msgJSON.Payment.Amount,
-			PaymentBank:       msgJSON.Payment.Bank,
-			DeliveryCost:      msgJSON.Payment.DeliveryCost,
-			GoodsTotal:        msgJSON.Payment.GoodsTotal,
-			CustomFee:         msgJSON.Payment.CustomFee,
-			Locale:            msgJSON.Locale,
-			InternalSignature: msgJSON.InternalSignature,
-			CustomerID:        msgJSON.CustomerID,
-			DeliveryService:   msgJSON.DeliveryService,
-			Shardkey:          msgJSON.Shardkey,
-			SmID:              msgJSON.SmID,
-			OofShard:          msgJSON.OofShard,
+	if cfg.DB.AutoMigrate {
+		if err := migrateUp(); err != nil {
+			fatal("Ошибка миграции БД", err)
 		}
+	} else if err := checkSchema(); err != nil {
+		fatal("Схема БД не совпадает с версией сервиса", err)
+	}
 
-		order.PaymentDt = time.Unix(msgJSON.Payment.PaymentDt, 0).UTC()
-		if t, err := time.Parse(time.RFC3339, msgJSON.DateCreated); err == nil {
-			order.DateCreated = t
-		} else {
-			order.DateCreated = time.Now()
+	// Остановка по SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := initTracing(ctx)
+	if err != nil {
+		fatal("Ошибка настройки трассировки", err)
+	}
+
+	// Повторная обработка канала отдельным процессом: go run . [флаги] replay ...
+	if len(args) > 0 && args[0] == "replay" {
+		err := runReplayCommand(ctx, args[1:])
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Warn("Ошибка выгрузки трасс", errAttr(err))
+		}
+		if err != nil {
+			fatal("Ошибка повторной обработки", err)
 		}
+		return
+	}
 
-		for _, itemJSON := range msgJSON.Items {
-			order.Items = append(order.Items, Item{
-				ChrtID:      itemJSON.ChrtID,
-				TrackNumber: itemJSON.TrackNumber,
-				Price:       itemJSON.Price,
-				Rid:         itemJSON.Rid,
-				Name:        itemJSON.Name,
-				Sale:        itemJSON.Sale,
-				Size:        itemJSON.Size,
-				TotalPrice:  itemJSON.TotalPrice,
-				NmID:        itemJSON.NmID,
-				Brand:       itemJSON.Brand,
-				Status:      itemJSON.Status,
-			})
+	cache = NewOrderCache(cfg.Cache.MaxEntries, cfg.Cache.TTL, loadOrderFromDB)
+
+	// Кэш восстанавливается в фоне; пока он не прогрет, веб-сервер читает промахи из БД
+	go func() {
+		if err := restoreCacheFromDB(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Ошибка восстановления кэша из БД", errAttr(err))
 		}
+	}()
 
-		if err := saveToDB(order); err != nil {
-			log.Printf("❌ Ошибка записи в БД: %v", err)
-			return
+	// Журнал обработанных сообщений очищается по сроку хранения канала
+	go runLedgerCleanup(ctx)
+
+	sc, err := stan.Connect(cfg.NATS.ClusterID, cfg.NATS.ClientID,
+		stan.NatsURL(cfg.NATS.URL),
+		stan.ConnectWait(cfg.NATS.ConnectTimeout),
+		stan.SetConnectionLostHandler(onNATSConnectionLost),
+	)
+	if err != nil {
+		fatal("Не удалось подключиться к NATS Streaming", err)
+	}
+	natsConn = sc
+
+	slog.Info("Подключен к NATS Streaming", "url", redactURL(cfg.NATS.URL))
+
+	if cfg.Batch.Enabled {
+		batcher = newOrderBatcher()
+		slog.Info("Пакетная запись заказов включена", "batch_size", cfg.Batch.Size, "batch_wait", cfg.Batch.Wait.String())
+	}
+
+	// Сообщения обрабатываются пулом воркеров; обновления одного заказа — по порядку
+	workerPool = newMessagePool(cfg.Workers.Count, cfg.Workers.QueueSize, handleOrderMessage)
+
+	// Durable-подписка с ручным подтверждением: сервер помнит позицию по имени,
+	// а сообщение подтверждается только после коммита транзакции в PostgreSQL.
+	// Неподтверждённые сообщения будут доставлены повторно через AckWait.
+	subOpts := []stan.SubscriptionOption{
+		stan.DurableName(cfg.NATS.DurableName),
+		stan.SetManualAckMode(),
+		stan.AckWait(cfg.NATS.AckWait),
+		stan.MaxInflight(cfg.NATS.MaxInflight),
+	}
+	// Начальная позиция действует только при первом запуске с новым durable-именем:
+	// с nats.deliver_all_available сервис прочитает всю историю канала, иначе — только
+	// сообщения, опубликованные после подписки. Дальше сервер продолжает с сохранённой позиции.
+	if cfg.NATS.DeliverAllAvailable {
+		subOpts = append(subOpts, stan.DeliverAllAvailable())
+	}
+	sub, err := sc.Subscribe(cfg.NATS.Channel, workerPool.Dispatch, subOpts...)
+	if err != nil {
+		fatal("Ошибка подписки", err)
+	}
+
+	slog.Info("Подписка на канал заказов",
+		"durable_name", cfg.NATS.DurableName,
+		"channel", cfg.NATS.Channel,
+		"ack_wait", cfg.NATS.AckWait.String(),
+		"max_inflight", cfg.NATS.MaxInflight,
+		"workers", cfg.Workers.Count,
+	)
+
+	// Запуск веб-интерфейса
+	srv, serverErr := StartWebServer()
+
+	select {
+	case <-ctx.Done():
+		slog.Info("Получен сигнал остановки")
+	case err := <-serverErr:
+		slog.Error("Веб-сервер завершился с ошибкой", errAttr(err))
+	}
+	stop()
+
+	shutdown(workerPool, sub, sc, srv, shutdownTracing)
+}
+
+// handleOrderMessage разбирает сообщение из канала orders, сохраняет заказ в БД
+// и подтверждает сообщение. При ошибке записи сообщение не подтверждается,
+// чтобы NATS Streaming доставил его повторно. Некорректные сообщения уходят в DLQ.
+// Вызывается из воркера messagePool.
+func handleOrderMessage(msg *stan.Msg) {
+	if !enterHandler() {
+		return
+	}
+	defer leaveHandler()
+
+	// Контекст трассы берётся из полей traceparent/tracestate сообщения, если они есть
+	ctx := extractMessageContext(context.Background(), msg.Data)
+	ctx, span := tracer.Start(ctx, cfg.NATS.Channel+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(messageSpanAttributes(cfg.NATS.Channel, msg.Sequence, msg.Redelivered)...),
+	)
+	defer span.End()
+	logger := logFromContext(ctx).With(logKeyNatsSeq, msg.Sequence)
+
+	messagesReceived.Inc()
+	if msg.Redelivered {
+		messagesRedelivered.Inc()
+		logger.Info("Повторная доставка сообщения")
+	}
+
+	// Сообщение, уже записанное в журнал processed_messages, только подтверждается.
+	// Если журнал недоступен, сообщение обрабатывается: повторную запись того же
+	// заказа всё равно отсечёт сравнение хэша содержимого в saveToDB.
+	entry := messageLedgerEntry(msg)
+	if dup, err := isDuplicateMessage(ctx, entry); err != nil {
+		logger.Warn("Не удалось проверить журнал обработанных сообщений", errAttr(err))
+	} else if dup {
+		ordersDeduplicated.WithLabelValues(dedupMessage).Inc()
+		span.SetAttributes(attribute.Bool("messaging.duplicate", true))
+		logger.Info("Сообщение уже обработано, повторная доставка пропущена")
+		ackMessage(msg)
+		return
+	}
+
+	order, rej := decodeOrderMessage(msg)
+	if rej != nil {
+		rejectAndAck(ctx, msg, rej.kind, rej.reason, rej.errs)
+		return
+	}
+	span.SetAttributes(attribute.String("order.uid", order.OrderUID))
+	logger = logger.With(logKeyOrderUID, order.OrderUID)
+
+	if order.Flagged {
+		logger.Warn("Заказ помечен: суммы не сходятся", "flag_reasons", order.FlagReasons)
+		ordersFlagged.Inc()
+		span.SetAttributes(attribute.Bool("order.flagged", true))
+	}
+
+	// В режиме пакетной записи заказ копится в batcher и подтверждается после коммита пакета
+	if batcher != nil {
+		batcher.Add(pendingOrder{ctx: ctx, msg: msg, entry: entry, order: order})
+		return
+	}
+	storeOrder(ctx, msg, entry, &order)
+}
+
+// orderRejection — причина, по которой сообщение не может быть сохранено
+type orderRejection struct {
+	kind   string // метка для метрик: rejectInvalidJSON, rejectValidation, rejectReconcile
+	reason string
+	errs   ValidationErrors
+}
+
+// decodeOrderMessage разбирает сообщение, проверяет заказ и сверяет суммы.
+// В режиме reconcile.mode = warn заказ с несходящимися суммами возвращается помеченным.
+// Используется и обработчиком подписки, и повторной обработкой канала (replay.go).
+func decodeOrderMessage(msg *stan.Msg) (Order, *orderRejection) {
+	var msgJSON OrderJSON
+	if err := json.Unmarshal(msg.Data, &msgJSON); err != nil {
+		return Order{}, &orderRejection{kind: rejectInvalidJSON, reason: "ошибка разбора JSON: " + err.Error()}
+	}
+
+	if errs := validateOrder(msgJSON); len(errs) > 0 {
+		return Order{}, &orderRejection{kind: rejectValidation, reason: "заказ не прошёл проверку", errs: errs}
+	}
+
+	order := orderFromJSON(msgJSON)
+	order.NatsSeq = msg.Sequence
+	order.MessageTime = messageTime(msg)
+
+	if errs := reconcileOrder(msgJSON); len(errs) > 0 {
+		if cfg.Reconcile.Mode == reconcileReject {
+			return Order{}, &orderRejection{kind: rejectReconcile, reason: "суммы заказа не сходятся", errs: errs}
 		}
+		order.Flagged = true
+		for _, e := range errs {
+			order.FlagReasons = append(order.FlagReasons, e.Field+": "+e.Message)
+		}
+	}
+	return order, nil
+}
 
-		cacheMutex.Lock()
-		cache[order.OrderUID] = order
-		cacheMutex.Unlock()
+// storeOrder записывает один заказ (с повторами при временных ошибках) и подтверждает сообщение
+func storeOrder(ctx context.Context, msg *stan.Msg, entry *ledgerEntry, order *Order) {
+	logger := logFromContext(ctx).With(logKeyNatsSeq, msg.Sequence, logKeyOrderUID, order.OrderUID)
 
-		log.Printf("✅ Получено и сохранено: %s", order.OrderUID)
+	start := time.Now()
+	var result string
+	err := withDBRetry(ctx, func() (err error) {
+		result, err = saveToDB(ctx, order, entry)
+		return err
 	})
+	elapsed := time.Since(start)
+	dbSaveDuration.Observe(elapsed.Seconds())
+	if isInterruptedDBError(err) {
+		// Запись прервана остановкой сервиса: сообщение не подтверждается и придёт повторно
+		logger.Warn("Запись в БД прервана остановкой сервиса", errAttr(err), durationAttr(elapsed))
+		return
+	}
 	if err != nil {
-		log.Fatal("Ошибка подписки:", err)
+		dbSaveErrors.Inc()
+		trace.SpanFromContext(ctx).SetStatus(codes.Error, err.Error())
+		if !isTransientDBError(err) {
+			// Повтор не поможет: сообщение уходит в DLQ, чтобы не блокировать канал
+			logger.Error("Постоянная ошибка записи в БД", errAttr(err), durationAttr(elapsed))
+			rejectAndAck(ctx, msg, rejectDBPermanent, "ошибка записи в БД: "+err.Error(), nil)
+			return
+		}
+		// Сообщение не подтверждается и будет доставлено повторно через AckWait
+		logger.Error("Ошибка записи в БД", errAttr(err), durationAttr(elapsed))
+		return
 	}
+	orderSaved(ctx, msg, entry, order, result, elapsed)
+}
 
-	// Запуск веб-интерфейса
-	StartWebServer()
-}
\ No newline at end of file
+// orderSaved завершает обработку сообщения по итогу saveToDB или пакетной записи
+func orderSaved(ctx context.Context, msg *stan.Msg, entry *ledgerEntry, order *Order, result string, elapsed time.Duration) {
+	logger := logFromContext(ctx).With(logKeyNatsSeq, msg.Sequence, logKeyOrderUID, order.OrderUID)
+	switch result {
+	case ledgerStale:
+		staleOrder(ctx, msg, entry, order)
+	case ledgerUnchanged:
+		orderStored(msg, *order, false)
+		ordersDeduplicated.WithLabelValues(dedupUnchanged).Inc()
+		logger.Info("Заказ не изменился, запись пропущена", "version", order.Version, durationAttr(elapsed))
+	default:
+		orderStored(msg, *order, true)
+		logger.Info("Заказ сохранён", "version", order.Version, durationAttr(elapsed))
+	}
+}
+
+// orderStored вызывается после коммита: подтверждает сообщение и обновляет кэш.
+// written — заказ действительно записан (а не пропущен как неизменившийся)
+func orderStored(msg *stan.Msg, order Order, written bool) {
+	ackMessage(msg)
+	if written {
+		messagesSaved.Inc()
+		lastMessageAt.Store(time.Now().UnixNano())
+	}
+	cache.Set(order)
+}
+
+// ackMessage подтверждает сообщение; ошибка подтверждения приведёт к повторной доставке
+func ackMessage(msg *stan.Msg) {
+	if err := msg.Ack(); err != nil {
+		slog.Warn("Не удалось подтвердить сообщение", logKeyNatsSeq, msg.Sequence, errAttr(err))
+	}
+}
+
+// rejectAndAck отправляет сообщение в DLQ и подтверждает его только после записи в order_rejects
+// kind — причина для метрик (rejectInvalidJSON, rejectValidation, rejectReconcile, rejectDBPermanent)
+func rejectAndAck(ctx context.Context, msg *stan.Msg, kind, reason string, fieldErrs ValidationErrors) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("order.reject_reason", kind))
+	if err := rejectMessage(ctx, msg, reason, fieldErrs); err != nil {
+		logFromContext(ctx).Error("Ошибка записи отклонённого сообщения", logKeyNatsSeq, msg.Sequence, errAttr(err))
+		return
+	}
+	messagesRejected.WithLabelValues(kind).Inc()
+	// Без записи в журнал повторная доставка снова попала бы в order_rejects
+	if err := recordMessage(ctx, DB, messageLedgerEntry(msg), "", ledgerRejected); err != nil {
+		logFromContext(ctx).Warn("Не удалось записать сообщение в журнал", logKeyNatsSeq, msg.Sequence, errAttr(err))
+	}
+	ackMessage(msg)
+}
+
+// orderFromJSON преобразует входящее сообщение в структуру Order для записи в БД
+func orderFromJSON(msgJSON OrderJSON) Order {
+	order := Order{
+		OrderUID:           msgJSON.OrderUID,
+		TrackNumber:        msgJSON.TrackNumber,
+		Entry:              msgJSON.Entry,
+		DeliveryName:       msgJSON.Delivery.Name,
+		DeliveryPhone:      msgJSON.Delivery.Phone,
+		DeliveryZip:        msgJSON.Delivery.Zip,
+		DeliveryCity:       msgJSON.Delivery.City,
+		DeliveryAddress:    msgJSON.Delivery.Address,
+		DeliveryRegion:     msgJSON.Delivery.Region,
+		DeliveryEmail:      msgJSON.Delivery.Email,
+		PaymentTransaction: msgJSON.Payment.Transaction,
+		PaymentRequestID:   msgJSON.Payment.RequestID,
+		PaymentCurrency:    msgJSON.Payment.Currency,
+		PaymentProvider:    msgJSON.Payment.Provider,
+		PaymentAmount:      msgJSON.Payment.Amount,
+		PaymentBank:        msgJSON.Payment.Bank,
+		DeliveryCost:       msgJSON.Payment.DeliveryCost,
+		GoodsTotal:         msgJSON.Payment.GoodsTotal,
+		CustomFee:          msgJSON.Payment.CustomFee,
+		Locale:             msgJSON.Locale,
+		InternalSignature:  msgJSON.InternalSignature,
+		CustomerID:         msgJSON.CustomerID,
+		DeliveryService:    msgJSON.DeliveryService,
+		Shardkey:           msgJSON.Shardkey,
+		SmID:               msgJSON.SmID,
+		OofShard:           msgJSON.OofShard,
+		ProducerVersion:    msgJSON.ProducerVersion,
+	}
+
+	order.PaymentDt = time.Unix(msgJSON.Payment.PaymentDt, 0).UTC()
+	if t, err := time.Parse(time.RFC3339, msgJSON.DateCreated); err == nil {
+		order.DateCreated = t
+	} else {
+		order.DateCreated = time.Now()
+	}
+
+	for _, itemJSON := range msgJSON.Items {
+		order.Items = append(order.Items, Item{
+			ChrtID:      itemJSON.ChrtID,
+			TrackNumber: itemJSON.TrackNumber,
+			Price:       itemJSON.Price,
+			Rid:         itemJSON.Rid,
+			Name:        itemJSON.Name,
+			Sale:        itemJSON.Sale,
+			Size:        itemJSON.Size,
+			TotalPrice:  itemJSON.TotalPrice,
+			NmID:        itemJSON.NmID,
+			Brand:       itemJSON.Brand,
+			Status:      itemJSON.Status,
+		})
+	}
+
+	return order
+}
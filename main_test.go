@@ -0,0 +1,53 @@
+// main_test.go
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"testing"
+)
+
+// orderCase — заказ из model.json, изменённый modify, и поля, в которых ожидаются ошибки
+type orderCase struct {
+	name   string
+	modify func(o *OrderJSON)
+	want   []string
+}
+
+// testOrder — корректный заказ из model.json
+func testOrder(t *testing.T) OrderJSON {
+	t.Helper()
+	data, err := os.ReadFile("model.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var o OrderJSON
+	if err := json.Unmarshal(data, &o); err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func errorFields(errs ValidationErrors) []string {
+	var fields []string
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	return fields
+}
+
+// checkOrderCases проверяет каждый случай функцией check (validateOrder, reconcileOrder)
+// и сравнивает поля ошибок с ожидаемыми
+func checkOrderCases(t *testing.T, cases []orderCase, check func(OrderJSON) ValidationErrors) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := testOrder(t)
+			tc.modify(&o)
+			if got := errorFields(check(o)); !slices.Equal(got, tc.want) {
+				t.Fatalf("ошибки в полях %v, ожидалось %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+// metrics.go
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Причины отклонения сообщений (метка reason)
+const (
+	rejectInvalidJSON = "invalid_json"
+	rejectValidation  = "validation"
+	rejectReconcile   = "reconcile"
+	rejectDBPermanent = "db_permanent"
+	rejectStale       = "stale"
+)
+
+// Причины, по которым сообщение обработано без записи заказа (метка reason)
+const (
+	dedupMessage   = "duplicate_message"
+	dedupUnchanged = "unchanged"
+)
+
+// Результаты попыток записи в БД (метка result)
+const (
+	attemptOK        = "ok"
+	attemptTransient = "transient_error"
+	attemptPermanent = "permanent_error"
+)
+
+var (
+	messagesReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_messages_received_total",
+		Help: "Сообщения, полученные из канала заказов.",
+	})
+	messagesRedelivered = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_messages_redelivered_total",
+		Help: "Повторные доставки сообщений NATS Streaming.",
+	})
+	messagesRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "orders_messages_rejected_total",
+		Help: "Сообщения, отправленные в DLQ, по причине.",
+	}, []string{"reason"})
+	messagesSaved = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_messages_saved_total",
+		Help: "Заказы, успешно сохранённые в БД.",
+	})
+	ordersDeduplicated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "orders_deduplicated_total",
+		Help: "Сообщения, подтверждённые без записи заказа: повторная доставка или неизменившийся заказ.",
+	}, []string{"reason"})
+	ledgerPurged = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_ledger_purged_total",
+		Help: "Записи журнала processed_messages, удалённые по сроку хранения.",
+	})
+	staleUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "orders_stale_updates_total",
+		Help: "Обновления заказов старше сохранённых, по действию (skip или quarantine).",
+	}, []string{"action"})
+	ordersFlagged = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_flagged_total",
+		Help: "Заказы, сохранённые с пометкой о несходящихся суммах.",
+	})
+
+	replayMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "orders_replay_messages_total",
+		Help: "Сообщения, повторно обработанные командой или эндпоинтом replay, по результату.",
+	}, []string{"result"})
+
+	dbBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "orders_db_batch_size",
+		Help:    "Число заказов в пакете записи.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 11),
+	})
+	dbBatchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "orders_db_batch_duration_seconds",
+		Help:    "Длительность записи пакета заказов в БД с учётом повторов.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	workerQueueFull = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_worker_queue_full_total",
+		Help: "Случаи, когда очередь воркера была заполнена и приём сообщений приостанавливался.",
+	})
+
+	dbSaveDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "orders_db_save_duration_seconds",
+		Help:    "Длительность записи заказа в БД с учётом повторов.",
+		Buckets: prometheus.DefBuckets,
+	})
+	dbSaveErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_db_save_errors_total",
+		Help: "Заказы, которые не удалось записать в БД после всех попыток.",
+	})
+	dbSaveAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "orders_db_save_attempts_total",
+		Help: "Попытки записи заказа в БД по результату.",
+	}, []string{"result"})
+	dbTxRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "orders_db_tx_retries_total",
+		Help: "Повторные попытки транзакций записи заказа.",
+	})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "orders_http_request_duration_seconds",
+		Help:    "Длительность HTTP-запросов по маршруту.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+)
+
+func init() {
+	// Показатели кэша снимаются при каждом опросе /metrics
+	cacheStat := func(f func(CacheStats) float64) func() float64 {
+		return func() float64 {
+			if cache == nil {
+				return 0
+			}
+			return f(cache.Stats())
+		}
+	}
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "orders_cache_entries",
+		Help: "Число заказов в кэше.",
+	}, cacheStat(func(s CacheStats) float64 { return float64(s.Entries) }))
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "orders_cache_hits_total",
+		Help: "Попадания в кэш заказов.",
+	}, cacheStat(func(s CacheStats) float64 { return float64(s.Hits) }))
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "orders_cache_misses_total",
+		Help: "Промахи кэша заказов.",
+	}, cacheStat(func(s CacheStats) float64 { return float64(s.Misses) }))
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "orders_cache_evictions_total",
+		Help: "Заказы, вытесненные из кэша (LRU).",
+	}, cacheStat(func(s CacheStats) float64 { return float64(s.Evictions) }))
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Name: "orders_cache_expired_total",
+		Help: "Записи кэша, удалённые по TTL.",
+	}, cacheStat(func(s CacheStats) float64 { return float64(s.Expired) }))
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "orders_worker_queue_length",
+		Help: "Сообщения, ожидающие обработки в очередях воркеров.",
+	}, func() float64 {
+		if workerPool == nil {
+			return 0
+		}
+		return float64(workerPool.QueueLen())
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "orders_cache_warmed",
+		Help: "1, если кэш восстановлен из БД.",
+	}, func() float64 {
+		if cacheWarmed.Load() {
+			return 1
+		}
+		return 0
+	})
+}
+
+// statusRecorder запоминает код ответа для метрик
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// metricsMiddleware измеряет длительность запросов; маршрут берётся из шаблона mux,
+// чтобы /order/{uid} не порождал отдельную метку на каждый заказ
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		route := "unknown"
+		if cur := mux.CurrentRoute(r); cur != nil {
+			if tpl, err := cur.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		httpRequestDuration.WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).
+			Observe(time.Since(start).Seconds())
+	})
+}
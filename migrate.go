@@ -0,0 +1,295 @@
+// migrate.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Миграции схемы БД: migrations/NNNN_описание.up.sql и NNNN_описание.down.sql
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// Ключ advisory-блокировки, чтобы миграции не выполнялись одновременно несколькими экземплярами
+const migrationLockID = 7238400117
+
+type migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// loadMigrations читает встроенные миграции, отсортированные по версии
+func loadMigrations() ([]migration, error) {
+	files, err := fs.Glob(migrationsFS, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*migration)
+	for _, file := range files {
+		base := path.Base(file)
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("файл миграции %s: ожидается суффикс .up.sql или .down.sql", base)
+		}
+
+		num, name, ok := strings.Cut(strings.TrimSuffix(base, "."+direction+".sql"), "_")
+		version, err := strconv.ParseInt(num, 10, 64)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("файл миграции %s: ожидается имя вида 0001_описание", base)
+		}
+
+		body, err := migrationsFS.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("миграция %04d_%s: нет файла .up.sql", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// migrator выполняет миграции на одном соединении, удерживая advisory-блокировку
+type migrator struct {
+	conn       *sql.Conn
+	migrations []migration
+}
+
+// withMigrator открывает соединение, берёт блокировку и вызывает fn
+func withMigrator(fn func(m *migrator) error) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Сессионная блокировка: второй экземпляр дождётся окончания миграций
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("advisory-блокировка: %w", err)
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("создание schema_migrations: %w", err)
+	}
+
+	return fn(&migrator{conn: conn, migrations: migrations})
+}
+
+func (m *migrator) applied() (map[int64]bool, error) {
+	rows, err := m.conn.QueryContext(context.Background(), "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]bool)
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		applied[v] = true
+	}
+	return applied, rows.Err()
+}
+
+// checkNotNewer отказывает, если в БД применены миграции, которых нет в этой сборке
+func (m *migrator) checkNotNewer(applied map[int64]bool) error {
+	known := make(map[int64]bool, len(m.migrations))
+	var latest int64
+	for _, mg := range m.migrations {
+		known[mg.Version] = true
+		latest = mg.Version
+	}
+	for v := range applied {
+		if !known[v] {
+			return fmt.Errorf("схема БД содержит миграцию %04d, неизвестную этой сборке (последняя известная — %04d): обновите сервис", v, latest)
+		}
+	}
+	return nil
+}
+
+// exec выполняет одну миграцию в транзакции вместе с записью в schema_migrations
+func (m *migrator) exec(mg migration, up bool) error {
+	ctx := context.Background()
+	tx, err := m.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	body, record := mg.Up, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)"
+	if !up {
+		body, record = mg.Down, "DELETE FROM schema_migrations WHERE version = $1 AND name = $2"
+	}
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, mg.Version, mg.Name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrateUp применяет все ещё не применённые миграции
+func migrateUp() error {
+	return withMigrator(func(m *migrator) error {
+		applied, err := m.applied()
+		if err != nil {
+			return err
+		}
+		if err := m.checkNotNewer(applied); err != nil {
+			return err
+		}
+
+		for _, mg := range m.migrations {
+			if applied[mg.Version] {
+				continue
+			}
+			if err := m.exec(mg, true); err != nil {
+				return fmt.Errorf("миграция %04d_%s: %w", mg.Version, mg.Name, err)
+			}
+			slog.Info("Применена миграция", "version", mg.Version, "name", mg.Name)
+		}
+		return nil
+	})
+}
+
+// migrateDown откатывает последние steps применённых миграций
+func migrateDown(steps int) error {
+	return withMigrator(func(m *migrator) error {
+		applied, err := m.applied()
+		if err != nil {
+			return err
+		}
+		if err := m.checkNotNewer(applied); err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			mg := m.migrations[i]
+			if !applied[mg.Version] {
+				continue
+			}
+			if mg.Down == "" {
+				return fmt.Errorf("миграция %04d_%s: нет файла .down.sql", mg.Version, mg.Name)
+			}
+			if err := m.exec(mg, false); err != nil {
+				return fmt.Errorf("откат миграции %04d_%s: %w", mg.Version, mg.Name, err)
+			}
+			slog.Info("Откачена миграция", "version", mg.Version, "name", mg.Name)
+			steps--
+		}
+		return nil
+	})
+}
+
+// checkSchema проверяет, что все миграции применены и схема не новее сборки
+func checkSchema() error {
+	return withMigrator(func(m *migrator) error {
+		applied, err := m.applied()
+		if err != nil {
+			return err
+		}
+		if err := m.checkNotNewer(applied); err != nil {
+			return err
+		}
+		for _, mg := range m.migrations {
+			if !applied[mg.Version] {
+				return fmt.Errorf("миграция %04d_%s не применена: выполните migrate up", mg.Version, mg.Name)
+			}
+		}
+		return nil
+	})
+}
+
+// printMigrationStatus выводит список миграций и их состояние
+func printMigrationStatus() error {
+	return withMigrator(func(m *migrator) error {
+		applied, err := m.applied()
+		if err != nil {
+			return err
+		}
+		for _, mg := range m.migrations {
+			state := "не применена"
+			if applied[mg.Version] {
+				state = "применена"
+			}
+			fmt.Printf("%04d_%s\t%s\n", mg.Version, mg.Name, state)
+		}
+		return m.checkNotNewer(applied)
+	})
+}
+
+// runMigrateCommand — команда "migrate up | down [N] | status"
+func runMigrateCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("использование: migrate up | down [N] | status")
+	}
+
+	switch args[0] {
+	case "up":
+		return migrateUp()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("некорректное число шагов %q", args[1])
+			}
+			steps = n
+		}
+		return migrateDown(steps)
+	case "status":
+		return printMigrationStatus()
+	}
+	return fmt.Errorf("неизвестная подкоманда migrate %q", args[0])
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS order_items CASCADE;
+DROP TABLE IF EXISTS orders CASCADE;
+DROP FUNCTION IF EXISTS update_updated_at_column();
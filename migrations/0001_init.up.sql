@@ -1,12 +1,5 @@
--- Создание базы данных
-CREATE DATABASE orders;
-
--- Удаление таблиц при необходимости (для повторного запуска)
-DROP TABLE IF EXISTS order_items CASCADE;
-DROP TABLE IF EXISTS orders CASCADE;
-
 -- Основная таблица заказов
-CREATE TABLE orders (
+CREATE TABLE IF NOT EXISTS orders (
     id BIGSERIAL PRIMARY KEY,
     order_uid TEXT UNIQUE NOT NULL,
     track_number TEXT NOT NULL,
@@ -24,7 +17,7 @@ CREATE TABLE orders (
     payment_request_id TEXT,
     payment_currency CHAR(3),
     payment_provider TEXT,
-    payment_amount INTEGER,         
+    payment_amount INTEGER,
     payment_dt TIMESTAMPTZ,
     payment_bank TEXT,
     delivery_cost INTEGER,
@@ -43,7 +36,7 @@ CREATE TABLE orders (
 );
 
 -- Таблица позиций заказа
-CREATE TABLE order_items (
+CREATE TABLE IF NOT EXISTS order_items (
     id BIGSERIAL PRIMARY KEY,
     order_uid TEXT NOT NULL REFERENCES orders(order_uid) ON DELETE CASCADE,
     chrt_id BIGINT,
@@ -61,12 +54,12 @@ CREATE TABLE order_items (
 );
 
 -- Индексы
-CREATE INDEX idx_orders_order_uid ON orders(order_uid);
-CREATE INDEX idx_orders_track_number ON orders(track_number);
-CREATE INDEX idx_orders_customer_id ON orders(customer_id);
-CREATE INDEX idx_orders_date_created ON orders(date_created);
-CREATE INDEX idx_order_items_order_uid ON order_items(order_uid);
-CREATE INDEX idx_order_items_nm_id ON order_items(nm_id);
+CREATE INDEX IF NOT EXISTS idx_orders_order_uid ON orders(order_uid);
+CREATE INDEX IF NOT EXISTS idx_orders_track_number ON orders(track_number);
+CREATE INDEX IF NOT EXISTS idx_orders_customer_id ON orders(customer_id);
+CREATE INDEX IF NOT EXISTS idx_orders_date_created ON orders(date_created);
+CREATE INDEX IF NOT EXISTS idx_order_items_order_uid ON order_items(order_uid);
+CREATE INDEX IF NOT EXISTS idx_order_items_nm_id ON order_items(nm_id);
 
 -- Триггер для updated_at
 CREATE OR REPLACE FUNCTION update_updated_at_column()
@@ -77,8 +70,8 @@ BEGIN
 END;
 $$ LANGUAGE plpgsql;
 
+DROP TRIGGER IF EXISTS trigger_orders_updated_at ON orders;
 CREATE TRIGGER trigger_orders_updated_at
     BEFORE UPDATE ON orders
     FOR EACH ROW
     EXECUTE FUNCTION update_updated_at_column();
-
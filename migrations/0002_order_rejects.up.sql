@@ -0,0 +1,12 @@
+-- Отклонённые сообщения (dead-letter)
+CREATE TABLE IF NOT EXISTS order_rejects (
+    id BIGSERIAL PRIMARY KEY,
+    nats_seq BIGINT,
+    raw BYTEA NOT NULL,
+    reason TEXT NOT NULL,
+    errors JSONB,
+    rejected_at TIMESTAMPTZ DEFAULT NOW(),
+    resubmitted_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_rejects_rejected_at ON order_rejects(rejected_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_orders_flagged;
+ALTER TABLE orders DROP COLUMN IF EXISTS flag_reasons;
+ALTER TABLE orders DROP COLUMN IF EXISTS flagged;
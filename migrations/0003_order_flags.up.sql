@@ -0,0 +1,5 @@
+-- Сверка сумм: заказ сохранён, но суммы не сходятся
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS flagged BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS flag_reasons JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_orders_flagged ON orders(flagged) WHERE flagged;
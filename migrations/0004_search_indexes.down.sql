@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_orders_date_created;
+CREATE INDEX idx_orders_date_created ON orders(date_created);
+
+DROP INDEX IF EXISTS idx_orders_delivery_phone;
+DROP INDEX IF EXISTS idx_orders_payment_transaction;
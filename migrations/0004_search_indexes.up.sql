@@ -0,0 +1,6 @@
+-- Поиск по транзакции и телефону, курсорная пагинация по (date_created, id)
+CREATE INDEX IF NOT EXISTS idx_orders_payment_transaction ON orders(payment_transaction);
+CREATE INDEX IF NOT EXISTS idx_orders_delivery_phone ON orders((regexp_replace(delivery_phone, '[^0-9]', '', 'g')));
+
+DROP INDEX IF EXISTS idx_orders_date_created;
+CREATE INDEX idx_orders_date_created ON orders(date_created, id);
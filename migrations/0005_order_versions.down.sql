@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS order_versions;
+ALTER TABLE orders DROP COLUMN IF EXISTS nats_seq;
+ALTER TABLE orders DROP COLUMN IF EXISTS version;
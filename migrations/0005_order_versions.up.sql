@@ -0,0 +1,15 @@
+-- Версия заказа растёт при каждом обновлении; nats_seq — сообщение, создавшее версию
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS nats_seq BIGINT NOT NULL DEFAULT 0;
+
+-- История заказов: снимок каждой предыдущей версии (заказ вместе с позициями)
+CREATE TABLE IF NOT EXISTS order_versions (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid TEXT NOT NULL REFERENCES orders(order_uid) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    nats_seq BIGINT NOT NULL,
+    snapshot JSONB NOT NULL,
+    valid_from TIMESTAMPTZ NOT NULL,
+    recorded_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (order_uid, version)
+);
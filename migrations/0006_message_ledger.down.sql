@@ -0,0 +1,2 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS content_hash;
+DROP TABLE IF EXISTS processed_messages;
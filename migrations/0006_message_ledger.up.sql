@@ -0,0 +1,15 @@
+-- Журнал обработанных сообщений: повторная доставка того же сообщения (тот же номер
+-- и то же содержимое) подтверждается без записи заказа
+CREATE TABLE IF NOT EXISTS processed_messages (
+    nats_seq BIGINT PRIMARY KEY,
+    payload_hash BYTEA NOT NULL,
+    order_uid TEXT,
+    result TEXT NOT NULL,
+    processed_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Для очистки старых записей журнала
+CREATE INDEX IF NOT EXISTS idx_processed_messages_processed_at ON processed_messages(processed_at);
+
+-- Хэш содержимого заказа: заказ, совпадающий с сохранённым, не перезаписывается
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS content_hash BYTEA;
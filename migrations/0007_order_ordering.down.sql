@@ -0,0 +1,2 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS message_time;
+ALTER TABLE orders DROP COLUMN IF EXISTS producer_version;
@@ -0,0 +1,4 @@
+-- Защита от обновлений не по порядку: версия заказа у производителя
+-- и время публикации сообщения, из которого записана текущая версия
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS producer_version BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS message_time TIMESTAMPTZ;
@@ -0,0 +1,84 @@
+// ordering.go
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/nats-io/stan.go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Режимы защиты от обновлений, пришедших не по порядку
+const (
+	orderingSkip       = "skip"       // устаревшее обновление подтверждается без записи
+	orderingQuarantine = "quarantine" // устаревшее обновление уходит в DLQ
+	orderingOff        = "off"        // последнее пришедшее обновление всегда записывается
+)
+
+// Ключи сравнения обновления с сохранённым заказом
+const (
+	orderingKeyProducerVersion = "producer_version" // версия, присвоенная производителем
+	orderingKeyDateCreated     = "date_created"     // date_created заказа
+	orderingKeyMessageTime     = "message_time"     // время публикации сообщения в NATS Streaming
+)
+
+// staleUpdate сравнивает входящий заказ с сохранённым по ключам ordering.keys в заданном
+// порядке. Решает первый ключ, который есть у обоих заказов и значения которого различаются:
+// обновление устарело, если его значение меньше. Если ни один ключ не решил, обновление
+// считается новым. Возвращает решивший ключ.
+func staleUpdate(incoming, stored Order) (key string, stale bool) {
+	if cfg.Ordering.Mode == orderingOff {
+		return "", false
+	}
+	for _, key := range cfg.Ordering.Keys {
+		switch key {
+		case orderingKeyProducerVersion:
+			if incoming.ProducerVersion > 0 && stored.ProducerVersion > 0 && incoming.ProducerVersion != stored.ProducerVersion {
+				return key, incoming.ProducerVersion < stored.ProducerVersion
+			}
+		case orderingKeyDateCreated:
+			if !incoming.DateCreated.IsZero() && !stored.DateCreated.IsZero() && !incoming.DateCreated.Equal(stored.DateCreated) {
+				return key, incoming.DateCreated.Before(stored.DateCreated)
+			}
+		case orderingKeyMessageTime:
+			if incoming.MessageTime != nil && stored.MessageTime != nil && !incoming.MessageTime.Equal(*stored.MessageTime) {
+				return key, incoming.MessageTime.Before(*stored.MessageTime)
+			}
+		}
+	}
+	return "", false
+}
+
+// messageTime — время публикации сообщения, присвоенное сервером NATS Streaming
+func messageTime(msg *stan.Msg) *time.Time {
+	if msg.Timestamp == 0 {
+		return nil
+	}
+	t := time.Unix(0, msg.Timestamp).UTC()
+	return &t
+}
+
+// staleOrder обрабатывает обновление, которое старше сохранённого заказа. В режиме skip
+// сообщение отмечается в журнале processed_messages с итогом stale и подтверждается,
+// в режиме quarantine — сохраняется в order_rejects и публикуется в DLQ.
+func staleOrder(ctx context.Context, msg *stan.Msg, entry *ledgerEntry, order *Order) {
+	logger := logFromContext(ctx).With(logKeyNatsSeq, msg.Sequence, logKeyOrderUID, order.OrderUID)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("order.stale", true))
+
+	if cfg.Ordering.Mode == orderingQuarantine {
+		staleUpdates.WithLabelValues(orderingQuarantine).Inc()
+		rejectAndAck(ctx, msg, rejectStale, "обновление старше сохранённого заказа", nil)
+		return
+	}
+
+	staleUpdates.WithLabelValues(orderingSkip).Inc()
+	if entry != nil {
+		if err := recordMessage(ctx, DB, entry, order.OrderUID, ledgerStale); err != nil {
+			logger.Warn("Не удалось записать сообщение в журнал", errAttr(err))
+		}
+	}
+	logger.Warn("Обновление старше сохранённого заказа, пропущено", "producer_version", order.ProducerVersion)
+	ackMessage(msg)
+}
@@ -0,0 +1,94 @@
+// ordering_test.go
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/stan.go"
+	"github.com/nats-io/stan.go/pb"
+)
+
+func TestStaleUpdate(t *testing.T) {
+	t0 := time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)
+	t1 := t0.Add(time.Second)
+	at := func(t time.Time) *time.Time { return &t }
+
+	defaultKeys := []string{orderingKeyProducerVersion, orderingKeyMessageTime}
+	tests := []struct {
+		name      string
+		mode      string
+		keys      []string
+		incoming  Order
+		stored    Order
+		wantKey   string
+		wantStale bool
+	}{
+		{"older version", orderingSkip, defaultKeys,
+			Order{ProducerVersion: 1, MessageTime: at(t1)}, Order{ProducerVersion: 2, MessageTime: at(t0)},
+			orderingKeyProducerVersion, true},
+		{"newer version", orderingSkip, defaultKeys,
+			Order{ProducerVersion: 3, MessageTime: at(t0)}, Order{ProducerVersion: 2, MessageTime: at(t1)},
+			orderingKeyProducerVersion, false},
+		{"equal version falls through to message time", orderingSkip, defaultKeys,
+			Order{ProducerVersion: 2, MessageTime: at(t0)}, Order{ProducerVersion: 2, MessageTime: at(t1)},
+			orderingKeyMessageTime, true},
+		{"version missing on incoming", orderingSkip, defaultKeys,
+			Order{MessageTime: at(t1)}, Order{ProducerVersion: 5, MessageTime: at(t0)},
+			orderingKeyMessageTime, false},
+		{"version missing on stored", orderingSkip, defaultKeys,
+			Order{ProducerVersion: 1, MessageTime: at(t0)}, Order{MessageTime: at(t1)},
+			orderingKeyMessageTime, true},
+		{"message time missing on stored", orderingSkip, defaultKeys,
+			Order{MessageTime: at(t0)}, Order{},
+			"", false},
+		{"message time missing on incoming", orderingSkip, defaultKeys,
+			Order{}, Order{MessageTime: at(t1)},
+			"", false},
+		{"same message time in other zone", orderingSkip, []string{orderingKeyMessageTime},
+			Order{MessageTime: at(t0.In(time.FixedZone("MSK", 3*60*60)))}, Order{MessageTime: at(t0)},
+			"", false},
+		{"older date_created", orderingSkip, []string{orderingKeyDateCreated},
+			Order{DateCreated: t0}, Order{DateCreated: t1},
+			orderingKeyDateCreated, true},
+		{"date_created missing on stored", orderingSkip, []string{orderingKeyDateCreated},
+			Order{DateCreated: t0}, Order{},
+			"", false},
+		{"key order decides", orderingSkip, []string{orderingKeyDateCreated, orderingKeyProducerVersion},
+			Order{DateCreated: t1, ProducerVersion: 1}, Order{DateCreated: t0, ProducerVersion: 2},
+			orderingKeyDateCreated, false},
+		{"no keys", orderingSkip, nil,
+			Order{ProducerVersion: 1}, Order{ProducerVersion: 2},
+			"", false},
+		{"quarantine mode compares", orderingQuarantine, defaultKeys,
+			Order{ProducerVersion: 1}, Order{ProducerVersion: 2},
+			orderingKeyProducerVersion, true},
+		{"off mode", orderingOff, defaultKeys,
+			Order{ProducerVersion: 1}, Order{ProducerVersion: 2},
+			"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := cfg.Ordering
+			t.Cleanup(func() { cfg.Ordering = prev })
+			cfg.Ordering = OrderingConfig{Mode: tt.mode, Keys: tt.keys}
+
+			key, stale := staleUpdate(tt.incoming, tt.stored)
+			if key != tt.wantKey || stale != tt.wantStale {
+				t.Fatalf("staleUpdate() = (%q, %v), want (%q, %v)", key, stale, tt.wantKey, tt.wantStale)
+			}
+		})
+	}
+}
+
+func TestMessageTime(t *testing.T) {
+	if got := messageTime(&stan.Msg{}); got != nil {
+		t.Fatalf("messageTime без времени = %v, want nil", got)
+	}
+
+	want := time.Date(2021, 11, 26, 6, 22, 19, 123, time.UTC)
+	got := messageTime(&stan.Msg{MsgProto: pb.MsgProto{Timestamp: want.UnixNano()}})
+	if got == nil || !got.Equal(want) || got.Location() != time.UTC {
+		t.Fatalf("messageTime() = %v, want %v", got, want)
+	}
+}
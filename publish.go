@@ -2,43 +2,260 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/nats-io/stan.go"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func main() {
-    PublishOrder()
+const publishUsage = `использование: publish file [флаги] [ФАЙЛ...]   — по заказу из каждого файла (по умолчанию model.json)
+              publish dir [флаги] КАТАЛОГ      — все *.json из каталога
+              publish ndjson [флаги] [ФАЙЛ|-]  — по заказу на строку, "-" или без аргумента — stdin`
+
+// publishOptions — флаги команды publish; по умолчанию берутся из конфигурации
+type publishOptions struct {
+	url       string
+	clusterID string
+	clientID  string
+	channel   string
+	rate      float64
+	dryRun    bool
+}
+
+// register добавляет общие флаги подключения и скорости; используется и командой load
+func (o *publishOptions) register(fs *flag.FlagSet, defaultRate float64) {
+	fs.StringVar(&o.url, "url", cfg.NATS.URL, "адрес NATS")
+	fs.StringVar(&o.clusterID, "cluster", cfg.NATS.ClusterID, "идентификатор кластера NATS Streaming")
+	fs.StringVar(&o.clientID, "client-id", cfg.NATS.PublisherClientID, "идентификатор клиента публикатора")
+	fs.StringVar(&o.channel, "channel", cfg.NATS.Channel, "канал заказов")
+	fs.Float64Var(&o.rate, "rate", defaultRate, "максимум сообщений в секунду, 0 — без ограничения")
+}
+
+// PublishSummary — итог публикации
+type PublishSummary struct {
+	Published int `json:"published"`
+	Failed    int `json:"failed"`
+}
+
+// publisher проверяет и отправляет заказы в канал NATS с ограничением скорости
+type publisher struct {
+	opts    publishOptions
+	sc      stan.Conn
+	limiter *time.Ticker
+	summary PublishSummary
+}
+
+// runPublishCommand — команда go run . [флаги] publish file|dir|ndjson [флаги] ...
+func runPublishCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(publishUsage)
+	}
+	mode := args[0]
+	switch mode {
+	case "file", "dir", "ndjson":
+	default:
+		return fmt.Errorf("неизвестная подкоманда publish %q\n%s", mode, publishUsage)
+	}
+
+	var opts publishOptions
+	fs := flag.NewFlagSet("publish "+mode, flag.ExitOnError)
+	opts.register(fs, 0)
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "только проверить заказы, ничего не отправляя")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if opts.rate < 0 {
+		return fmt.Errorf("-rate: не может быть отрицательным")
+	}
+
+	p, err := newPublisher(opts)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	start := time.Now()
+	switch mode {
+	case "file":
+		paths := fs.Args()
+		if len(paths) == 0 {
+			paths = []string{"model.json"}
+		}
+		for _, path := range paths {
+			p.publishFile(path)
+		}
+	case "dir":
+		if fs.NArg() != 1 {
+			return errors.New(publishUsage)
+		}
+		err = p.publishDir(fs.Arg(0))
+	case "ndjson":
+		path := fs.Arg(0)
+		if fs.NArg() > 1 {
+			return errors.New(publishUsage)
+		}
+		err = p.publishNDJSON(path)
+	}
+
+	slog.Info("Итог публикации",
+		"published", p.summary.Published,
+		"failed", p.summary.Failed,
+		"dry_run", opts.dryRun,
+		"channel", opts.channel,
+		durationAttr(time.Since(start)),
+	)
+	if err != nil {
+		return err
+	}
+	if p.summary.Failed > 0 {
+		return fmt.Errorf("не удалось опубликовать %d из %d сообщений",
+			p.summary.Failed, p.summary.Failed+p.summary.Published)
+	}
+	return nil
 }
 
-// PublishOrder отправляет заказ из файла model.json в канал NATS
-func PublishOrder() {
-	// Чтение файла model.json
-	data, err := os.ReadFile("model.json")
+// newPublisher подключается к NATS Streaming; в режиме dry-run подключения нет
+func newPublisher(opts publishOptions) (*publisher, error) {
+	p := &publisher{opts: opts}
+	if opts.rate > 0 {
+		p.limiter = time.NewTicker(time.Duration(float64(time.Second) / opts.rate))
+	}
+	if opts.dryRun {
+		return p, nil
+	}
+
+	sc, err := stan.Connect(opts.clusterID, opts.clientID,
+		stan.NatsURL(opts.url),
+		stan.ConnectWait(cfg.NATS.ConnectTimeout),
+	)
 	if err != nil {
-		log.Fatal("❌ Не удалось прочитать файл model.json:", err)
+		return nil, fmt.Errorf("подключение к NATS: %w", err)
+	}
+	p.sc = sc
+	return p, nil
+}
+
+func (p *publisher) Close() {
+	if p.limiter != nil {
+		p.limiter.Stop()
+	}
+	if p.sc != nil {
+		p.sc.Close()
 	}
+}
+
+// publish проверяет один заказ и отправляет его; source — файл или файл:строка для логов.
+// Возвращает true, если заказ отправлен (или прошёл проверку в режиме dry-run).
+func (p *publisher) publish(source string, data []byte) bool {
+	logger := slog.With("source", source)
 
-	// Проверка валидности JSON
-	var order map[string]interface{}
+	var order OrderJSON
 	if err := json.Unmarshal(data, &order); err != nil {
-		log.Fatal("❌ Неверный формат JSON в model.json:", err)
+		p.summary.Failed++
+		logger.Error("Неверный формат JSON", errAttr(err))
+		return false
+	}
+	logger = logger.With(logKeyOrderUID, order.OrderUID)
+	if errs := validateOrder(order); len(errs) > 0 {
+		p.summary.Failed++
+		logger.Error("Заказ не прошёл проверку", "field_errors", errs)
+		return false
+	}
+
+	if p.opts.dryRun {
+		p.summary.Published++
+		logger.Debug("Заказ прошёл проверку")
+		return true
+	}
+
+	if p.limiter != nil {
+		<-p.limiter.C
+	}
+
+	// Контекст трассы публикации передаётся сервису полями traceparent/tracestate
+	ctx, span := tracer.Start(context.Background(), p.opts.channel+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("nats-streaming"),
+			semconv.MessagingDestinationName(p.opts.channel),
+			attribute.String("order.uid", order.OrderUID),
+		),
+	)
+	data, err := withMessageContext(ctx, data)
+	if err == nil {
+		err = p.sc.Publish(p.opts.channel, data)
 	}
+	endSpan(span, err)
+	if err != nil {
+		p.summary.Failed++
+		logger.Error("Ошибка отправки сообщения в NATS", errAttr(err))
+		return false
+	}
+	p.summary.Published++
+	logger.Debug("Сообщение отправлено")
+	return true
+}
 
-	// Подключение к NATS Streaming
-	sc, err := stan.Connect("test-cluster", "publisher", stan.NatsURL("nats://localhost:4222"))
+func (p *publisher) publishFile(path string) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatal("❌ Ошибка подключения к NATS:", err)
+		p.summary.Failed++
+		slog.Error("Не удалось прочитать файл", "source", path, errAttr(err))
+		return
 	}
-	defer sc.Close()
+	p.publish(path, data)
+}
 
-	// Отправка сообщения
-	if err := sc.Publish("orders", data); err != nil {
-		log.Fatal("❌ Ошибка отправки сообщения в NATS:", err)
+// publishDir отправляет *.json из каталога в порядке имён файлов
+func (p *publisher) publishDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.EqualFold(filepath.Ext(e.Name()), ".json") {
+			continue
+		}
+		p.publishFile(filepath.Join(dir, e.Name()))
 	}
+	return nil
+}
 
-	log.Println("✅ Сообщение из model.json отправлено в канал 'orders'")
+// publishNDJSON отправляет по заказу на каждую непустую строку файла или stdin
+func (p *publisher) publishNDJSON(path string) error {
+	var r io.Reader = os.Stdin
+	name := "stdin"
+	if path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r, name = f, path
+	}
 
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		data := scanner.Bytes()
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+		// Scanner переиспользует буфер, а Publish может держать ссылку на данные
+		p.publish(fmt.Sprintf("%s:%d", name, line), append([]byte(nil), data...))
+	}
+	return scanner.Err()
 }
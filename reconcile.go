@@ -0,0 +1,78 @@
+// reconcile.go
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Режимы сверки финансовых сумм заказа
+const (
+	reconcileReject = "reject" // заказ отклоняется и уходит в DLQ
+	reconcileWarn   = "warn"   // заказ сохраняется, но помечается флагом
+	reconcileOff    = "off"    // сверка не выполняется
+)
+
+// Правила сверки
+const (
+	ruleGoodsTotal = "goods_total" // goods_total = Σ items[].total_price
+	ruleAmount     = "amount"      // amount = goods_total + delivery_cost + custom_fee
+	ruleItemTotal  = "item_total"  // total_price ≈ price × (100 − sale) / 100
+)
+
+// reconcileRuleEnabled сообщает, включено ли правило в настройках reconcile.rules
+func reconcileRuleEnabled(rule string) bool {
+	for _, r := range cfg.Reconcile.Rules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileOrder проверяет, что суммы платежа и позиций согласованы между собой.
+// Возвращает список расхождений в том же формате, что и validateOrder.
+func reconcileOrder(o OrderJSON) ValidationErrors {
+	var errs ValidationErrors
+	if cfg.Reconcile.Mode == reconcileOff {
+		return nil
+	}
+
+	tolerance := cfg.Reconcile.Tolerance
+
+	if reconcileRuleEnabled(ruleItemTotal) {
+		for i, item := range o.Items {
+			expected := int(math.Round(float64(item.Price) * float64(100-item.Sale) / 100))
+			if absInt(item.TotalPrice-expected) > tolerance {
+				errs.add(fmt.Sprintf("items[%d].total_price", i),
+					"ожидалось %d (price %d со скидкой %d%%), получено %d", expected, item.Price, item.Sale, item.TotalPrice)
+			}
+		}
+	}
+
+	if reconcileRuleEnabled(ruleGoodsTotal) {
+		sum := 0
+		for _, item := range o.Items {
+			sum += item.TotalPrice
+		}
+		if absInt(o.Payment.GoodsTotal-sum) > tolerance {
+			errs.add("payment.goods_total", "ожидалось %d (сумма total_price позиций), получено %d", sum, o.Payment.GoodsTotal)
+		}
+	}
+
+	if reconcileRuleEnabled(ruleAmount) {
+		expected := o.Payment.GoodsTotal + o.Payment.DeliveryCost + o.Payment.CustomFee
+		if absInt(o.Payment.Amount-expected) > tolerance {
+			errs.add("payment.amount", "ожидалось %d (goods_total + delivery_cost + custom_fee), получено %d", expected, o.Payment.Amount)
+		}
+	}
+
+	return errs
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
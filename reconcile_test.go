@@ -0,0 +1,79 @@
+// reconcile_test.go
+package main
+
+import "testing"
+
+// setReconcile задаёт настройки сверки на время теста
+func setReconcile(t *testing.T, mode string, rules []string, tolerance int) {
+	prev := cfg.Reconcile
+	t.Cleanup(func() { cfg.Reconcile = prev })
+	cfg.Reconcile = ReconcileConfig{Mode: mode, Rules: rules, Tolerance: tolerance}
+}
+
+func TestReconcileOrder(t *testing.T) {
+	allRules := []string{ruleGoodsTotal, ruleAmount, ruleItemTotal}
+	tests := []struct {
+		name      string
+		mode      string
+		rules     []string
+		tolerance int
+		cases     []orderCase
+	}{
+		{"exact", reconcileReject, allRules, 0, []orderCase{
+			{"consistent", func(o *OrderJSON) {}, nil},
+			{"amount off by one", func(o *OrderJSON) { o.Payment.Amount++ }, []string{"payment.amount"}},
+			{"custom fee counted", func(o *OrderJSON) {
+				o.Payment.CustomFee = 100
+				o.Payment.Amount += 100
+			}, nil},
+			// 453 со скидкой 30% = 317.1, округляется до 317
+			{"item total rounded", func(o *OrderJSON) {}, nil},
+			{"full sale", func(o *OrderJSON) {
+				o.Items[0].Sale, o.Items[0].TotalPrice = 100, 0
+				o.Payment.GoodsTotal, o.Payment.Amount = 0, o.Payment.DeliveryCost
+			}, nil},
+			{"all rules fail", func(o *OrderJSON) {
+				o.Items[0].TotalPrice = 1
+				o.Payment.Amount = 0
+			}, []string{"items[0].total_price", "payment.goods_total", "payment.amount"}},
+		}},
+		{"tolerance 1", reconcileReject, allRules, 1, []orderCase{
+			{"amount above by tolerance", func(o *OrderJSON) { o.Payment.Amount++ }, nil},
+			{"amount below by tolerance", func(o *OrderJSON) { o.Payment.Amount-- }, nil},
+			{"amount above tolerance", func(o *OrderJSON) { o.Payment.Amount += 2 }, []string{"payment.amount"}},
+			// goods_total не сходится с позициями, но amount пересчитан от goods_total
+			{"goods_total above tolerance", func(o *OrderJSON) {
+				o.Payment.GoodsTotal += 5
+				o.Payment.Amount += 5
+			}, []string{"payment.goods_total"}},
+		}},
+		{"tolerance 5", reconcileReject, allRules, 5, []orderCase{
+			{"goods_total equal to tolerance", func(o *OrderJSON) {
+				o.Payment.GoodsTotal += 5
+				o.Payment.Amount += 5
+			}, nil},
+		}},
+		{"item_total only", reconcileReject, []string{ruleItemTotal}, 1, []orderCase{
+			{"item total above tolerance", func(o *OrderJSON) { o.Items[0].TotalPrice = 315 }, []string{"items[0].total_price"}},
+			{"amount not checked", func(o *OrderJSON) { o.Payment.Amount = 0 }, nil},
+		}},
+		{"item_total tolerance 2", reconcileReject, []string{ruleItemTotal}, 2, []orderCase{
+			{"item total equal to tolerance", func(o *OrderJSON) { o.Items[0].TotalPrice = 315 }, nil},
+		}},
+		{"no rules", reconcileReject, nil, 0, []orderCase{
+			{"nothing checked", func(o *OrderJSON) { o.Payment.Amount = 0 }, nil},
+		}},
+		{"warn mode", reconcileWarn, allRules, 0, []orderCase{
+			{"reports", func(o *OrderJSON) { o.Payment.Amount = 0 }, []string{"payment.amount"}},
+		}},
+		{"off mode", reconcileOff, allRules, 0, []orderCase{
+			{"nothing checked", func(o *OrderJSON) { o.Payment.Amount = 0 }, nil},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setReconcile(t, tt.mode, tt.rules, tt.tolerance)
+			checkOrderCases(t, tt.cases, reconcileOrder)
+		})
+	}
+}
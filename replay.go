@@ -0,0 +1,453 @@
+// replay.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nats-io/stan.go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Состояния повторной обработки
+const (
+	replayRunning   = "running"
+	replayDone      = "done"
+	replayFailed    = "failed"
+	replayCancelled = "cancelled"
+)
+
+// Результаты обработки одного сообщения при replay (метка result)
+const (
+	replayChanged   = "changed"
+	replayUnchanged = "unchanged"
+	replayRejected  = "rejected"
+	replayStale     = "stale"
+	replayError     = "error"
+)
+
+// ReplayRequest — с какого места канала заказов начать повторную обработку.
+// Задаётся ровно одно из FromSeq, Since, All.
+type ReplayRequest struct {
+	FromSeq uint64     `json:"from_seq,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+	All     bool       `json:"all,omitempty"`
+	ToSeq   uint64     `json:"to_seq,omitempty"` // последнее обрабатываемое сообщение, 0 — до конца канала
+}
+
+func (r ReplayRequest) validate() error {
+	n := 0
+	if r.FromSeq > 0 {
+		n++
+	}
+	if r.Since != nil {
+		n++
+	}
+	if r.All {
+		n++
+	}
+	if n != 1 {
+		return errors.New("нужно указать ровно одно из from_seq, since, all")
+	}
+	if r.ToSeq > 0 && r.ToSeq < r.FromSeq {
+		return errors.New("to_seq не может быть меньше from_seq")
+	}
+	return nil
+}
+
+// startOption — позиция начала временной подписки
+func (r ReplayRequest) startOption() stan.SubscriptionOption {
+	switch {
+	case r.FromSeq > 0:
+		return stan.StartAtSequence(r.FromSeq)
+	case r.Since != nil:
+		return stan.StartAtTime(*r.Since)
+	}
+	return stan.DeliverAllAvailable()
+}
+
+// ReplayProgress — состояние повторной обработки (ответ /api/admin/replay)
+type ReplayProgress struct {
+	Request    ReplayRequest `json:"request"`
+	State      string        `json:"state"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	FirstSeq   uint64        `json:"first_seq,omitempty"`
+	LastSeq    uint64        `json:"last_seq,omitempty"`
+	Processed  int           `json:"processed"`
+	Changed    int           `json:"changed"`   // заказы, которые после обработки отличаются от записанных в БД
+	Unchanged  int           `json:"unchanged"` // заказы, совпавшие с БД; запись не выполнялась
+	Rejected   int           `json:"rejected"`  // сообщения, не прошедшие проверку
+	Stale      int           `json:"stale"`     // обновления старше сохранённых заказов (ordering.keys)
+	Failed     int           `json:"failed"`    // ошибки записи в БД
+	Error      string        `json:"error,omitempty"`
+}
+
+// replayJob — одна повторная обработка: временная (не durable) подписка на канал
+// заказов с заданной позиции. Сообщения проходят те же разбор, проверку и сверку,
+// что и в handleOrderMessage; заказ записывается, только если он отличается от
+// сохранённого в БД. Обработка заканчивается на сообщении ToSeq, на первом
+// сообщении, опубликованном после начала replay (его обработает основная
+// подписка), или если сообщений нет дольше nats.replay_idle_timeout.
+//
+// Отклонённые сообщения не отправляются в DLQ повторно — они там уже есть
+// с первой обработки; replay только считает их.
+type replayJob struct {
+	mu       sync.Mutex
+	progress ReplayProgress
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Текущая или последняя повторная обработка в работающем сервисе
+var (
+	replayMu     sync.Mutex
+	activeReplay *replayJob
+)
+
+// startReplay запускает повторную обработку в фоне на соединении sc
+func startReplay(sc stan.Conn, req ReplayRequest) *replayJob {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &replayJob{
+		progress: ReplayProgress{Request: req, State: replayRunning, StartedAt: time.Now()},
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(job.done)
+		job.finish(job.run(ctx, sc))
+	}()
+	return job
+}
+
+// Progress возвращает копию текущего состояния
+func (j *replayJob) Progress() ReplayProgress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.progress
+}
+
+// Stop прерывает обработку и ждёт её завершения
+func (j *replayJob) Stop() {
+	j.cancel()
+	<-j.done
+}
+
+func (j *replayJob) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.progress.FinishedAt = &now
+	switch {
+	case errors.Is(err, context.Canceled):
+		j.progress.State = replayCancelled
+	case err != nil:
+		j.progress.State = replayFailed
+		j.progress.Error = err.Error()
+	default:
+		j.progress.State = replayDone
+	}
+}
+
+func (j *replayJob) run(ctx context.Context, sc stan.Conn) error {
+	req := j.Progress().Request
+	startedAt := j.Progress().StartedAt
+
+	// Колбэк подписки только передаёт сообщение в цикл обработки; пока сообщение
+	// не подтверждено, сервер держит не больше nats.max_inflight сообщений в пути
+	msgs := make(chan *stan.Msg)
+	received, stopReceiving := context.WithCancel(ctx)
+	sub, err := sc.Subscribe(cfg.NATS.Channel, func(msg *stan.Msg) {
+		select {
+		case msgs <- msg:
+		case <-received.Done():
+		}
+	},
+		req.startOption(),
+		stan.SetManualAckMode(),
+		stan.AckWait(cfg.NATS.AckWait),
+		stan.MaxInflight(cfg.NATS.MaxInflight),
+	)
+	if err != nil {
+		stopReceiving()
+		return fmt.Errorf("подписка на канал %s: %w", cfg.NATS.Channel, err)
+	}
+	// Unsubscribe, а не Close: временная подписка удаляется с сервера.
+	// Сначала stopReceiving, чтобы колбэк не ждал цикл, который уже завершился.
+	defer sub.Unsubscribe()
+	defer stopReceiving()
+
+	slog.Info("Повторная обработка канала запущена",
+		"channel", cfg.NATS.Channel,
+		"from_seq", req.FromSeq,
+		"since", req.Since,
+		"all", req.All,
+		"to_seq", req.ToSeq,
+	)
+
+	idle := time.NewTimer(cfg.NATS.ReplayIdleTimeout)
+	defer idle.Stop()
+	report := time.NewTicker(5 * time.Second)
+	defer report.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-idle.C:
+			return nil
+		case <-report.C:
+			p := j.Progress()
+			slog.Info("Повторная обработка канала",
+				"last_seq", p.LastSeq, "processed", p.Processed, "changed", p.Changed)
+		case msg := <-msgs:
+			if (req.ToSeq > 0 && msg.Sequence > req.ToSeq) || msg.Timestamp >= startedAt.UnixNano() {
+				return nil
+			}
+			result := replayMessage(ctx, msg)
+			ackMessage(msg)
+			replayMessages.WithLabelValues(result).Inc()
+			j.record(msg.Sequence, result)
+			if req.ToSeq > 0 && msg.Sequence == req.ToSeq {
+				return nil
+			}
+			idle.Reset(cfg.NATS.ReplayIdleTimeout)
+		}
+	}
+}
+
+func (j *replayJob) record(seq uint64, result string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	p := &j.progress
+	if p.FirstSeq == 0 {
+		p.FirstSeq = seq
+	}
+	p.LastSeq = seq
+	p.Processed++
+	switch result {
+	case replayChanged:
+		p.Changed++
+	case replayUnchanged:
+		p.Unchanged++
+	case replayRejected:
+		p.Rejected++
+	case replayStale:
+		p.Stale++
+	case replayError:
+		p.Failed++
+	}
+}
+
+// replayMessage повторно обрабатывает одно сообщение и возвращает результат для метрик
+func replayMessage(ctx context.Context, msg *stan.Msg) string {
+	ctx = extractMessageContext(ctx, msg.Data)
+	ctx, span := tracer.Start(ctx, cfg.NATS.Channel+" replay",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(messageSpanAttributes(cfg.NATS.Channel, msg.Sequence, msg.Redelivered)...),
+	)
+	defer span.End()
+	logger := logFromContext(ctx).With(logKeyNatsSeq, msg.Sequence)
+
+	order, rej := decodeOrderMessage(msg)
+	if rej != nil {
+		logger.Debug("Сообщение не прошло проверку", "reason", rej.reason, "field_errors", rej.errs)
+		return replayRejected
+	}
+	span.SetAttributes(attribute.String("order.uid", order.OrderUID))
+	logger = logger.With(logKeyOrderUID, order.OrderUID)
+
+	current, found, err := loadOrderFromDB(ctx, order.OrderUID)
+	if err != nil {
+		endSpan(span, err)
+		logger.Error("Ошибка чтения заказа из БД", errAttr(err))
+		return replayError
+	}
+	if found {
+		changes, err := diffOrders(orderInUTC(current), orderInUTC(order))
+		if err != nil {
+			endSpan(span, err)
+			logger.Error("Ошибка сравнения заказа", errAttr(err))
+			return replayError
+		}
+		if len(changes) == 0 {
+			return replayUnchanged
+		}
+		span.SetAttributes(attribute.Int("order.changed_fields", len(changes)))
+	}
+
+	// Журнал processed_messages не трогается: сообщения в нём уже есть с первой обработки.
+	// Старые сообщения заказа, обновлённого позже, не перезаписывают его (staleUpdate).
+	var result string
+	if err := withDBRetry(ctx, func() (err error) {
+		result, err = saveToDB(ctx, &order, nil)
+		return err
+	}); err != nil {
+		endSpan(span, err)
+		logger.Error("Ошибка записи в БД", errAttr(err))
+		return replayError
+	}
+	switch result {
+	case ledgerStale:
+		logger.Debug("Сообщение старше сохранённого заказа")
+		return replayStale
+	case ledgerUnchanged:
+		return replayUnchanged
+	}
+	if cache != nil {
+		cache.Set(order)
+	}
+	logger.Info("Заказ обновлён повторной обработкой", "version", order.Version)
+	return replayChanged
+}
+
+// orderInUTC приводит даты заказа к UTC: прочитанные из БД даты приходят в часовом
+// поясе сессии и иначе отличались бы от дат из сообщения при сравнении
+func orderInUTC(o Order) Order {
+	o.PaymentDt = o.PaymentDt.UTC()
+	o.DateCreated = o.DateCreated.UTC()
+	return o
+}
+
+// stopReplay прерывает повторную обработку в работающем сервисе, если она идёт
+func stopReplay() {
+	replayMu.Lock()
+	job := activeReplay
+	replayMu.Unlock()
+	if job != nil {
+		job.Stop()
+	}
+}
+
+// POST /api/admin/replay — запуск повторной обработки; тело — ReplayRequest
+func startReplayHandler(w http.ResponseWriter, r *http.Request) {
+	var req ReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Некорректный JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if natsConn == nil || shuttingDown.Load() {
+		http.Error(w, "Нет подключения к NATS", http.StatusServiceUnavailable)
+		return
+	}
+
+	replayMu.Lock()
+	if activeReplay != nil && activeReplay.Progress().State == replayRunning {
+		replayMu.Unlock()
+		http.Error(w, "Повторная обработка уже идёт", http.StatusConflict)
+		return
+	}
+	activeReplay = startReplay(natsConn, req)
+	job := activeReplay
+	replayMu.Unlock()
+
+	logFromContext(r.Context()).Info("Запрошена повторная обработка канала")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.Progress())
+}
+
+// GET /api/admin/replay — состояние текущей или последней повторной обработки
+func replayStatusHandler(w http.ResponseWriter, r *http.Request) {
+	replayMu.Lock()
+	job := activeReplay
+	replayMu.Unlock()
+	if job == nil {
+		http.Error(w, "Повторная обработка не запускалась", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job.Progress())
+}
+
+// DELETE /api/admin/replay — прервать повторную обработку
+func cancelReplayHandler(w http.ResponseWriter, r *http.Request) {
+	replayMu.Lock()
+	job := activeReplay
+	replayMu.Unlock()
+	if job == nil || job.Progress().State != replayRunning {
+		http.Error(w, "Повторная обработка не идёт", http.StatusNotFound)
+		return
+	}
+	job.Stop()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job.Progress())
+}
+
+// runReplayCommand — go run . [флаги] replay -from-seq N | -since ВРЕМЯ | -all [-to-seq M]:
+// повторная обработка канала отдельным процессом с клиентом nats.replay_client_id.
+// Кэш работающего сервиса при этом не обновляется до истечения cache.ttl.
+func runReplayCommand(ctx context.Context, args []string) error {
+	var req ReplayRequest
+	var since string
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.Uint64Var(&req.FromSeq, "from-seq", 0, "начать с сообщения с этим номером")
+	fs.StringVar(&since, "since", "", "начать с сообщений, опубликованных после этого времени (RFC 3339)")
+	fs.BoolVar(&req.All, "all", false, "обработать все сообщения, хранящиеся в канале")
+	fs.Uint64Var(&req.ToSeq, "to-seq", 0, "закончить на сообщении с этим номером, 0 — до конца канала")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return fmt.Errorf("-since: ожидается время в RFC 3339: %w", err)
+		}
+		req.Since = &t
+	}
+	if err := req.validate(); err != nil {
+		return err
+	}
+
+	sc, err := stan.Connect(cfg.NATS.ClusterID, cfg.NATS.ReplayClientID,
+		stan.NatsURL(cfg.NATS.URL),
+		stan.ConnectWait(cfg.NATS.ConnectTimeout),
+	)
+	if err != nil {
+		return fmt.Errorf("подключение к NATS: %w", err)
+	}
+	defer sc.Close()
+
+	job := startReplay(sc, req)
+	select {
+	case <-job.done:
+	case <-ctx.Done():
+		job.Stop()
+	}
+
+	p := job.Progress()
+	slog.Info("Итог повторной обработки",
+		"state", p.State,
+		"first_seq", p.FirstSeq,
+		"last_seq", p.LastSeq,
+		"processed", p.Processed,
+		"changed", p.Changed,
+		"unchanged", p.Unchanged,
+		"rejected", p.Rejected,
+		"stale", p.Stale,
+		"failed", p.Failed,
+		durationAttr(p.FinishedAt.Sub(p.StartedAt)),
+	)
+	switch {
+	case p.Error != "":
+		return errors.New(p.Error)
+	case p.Failed > 0:
+		return fmt.Errorf("не удалось записать %d заказов", p.Failed)
+	}
+	return nil
+}
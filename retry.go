@@ -0,0 +1,125 @@
+// retry.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Коды PostgreSQL, после которых транзакцию имеет смысл повторить
+var transientPgCodes = map[string]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"55P03": true, // lock_not_available
+	"53300": true, // too_many_connections
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// isTransientDBError отличает временные ошибки БД (обрыв соединения, конфликт
+// сериализации, взаимоблокировка) от постоянных (нарушение ограничений, неверные данные).
+// Ошибки, пришедшие от сервера PostgreSQL, классифицируются по коду; ошибки
+// сети и соединения считаются временными; всё остальное — постоянным.
+func isTransientDBError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Класс 08 — connection_exception
+		return transientPgCodes[pgErr.Code] || strings.HasPrefix(pgErr.Code, "08")
+	}
+
+	var connErr *pgconn.ConnectError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &connErr), errors.As(err, &netErr):
+		return true
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone):
+		return true
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.Is(err, context.DeadlineExceeded):
+		return true
+	}
+	return pgconn.SafeToRetry(err) || pgconn.Timeout(err)
+}
+
+// isInterruptedDBError сообщает, что запись прервана остановкой сервиса: контекст
+// отменён или пул соединений уже закрыт (database/sql не экспортирует эту ошибку,
+// поэтому она сравнивается по тексту). Такая ошибка не говорит ничего о самом
+// сообщении: его не подтверждают и не отклоняют, NATS доставит его повторно.
+func isInterruptedDBError(err error) bool {
+	return errors.Is(err, context.Canceled) || err != nil && strings.Contains(err.Error(), "sql: database is closed")
+}
+
+// retryBackoff — пауза перед попыткой attempt (с 1): экспоненциальный рост от
+// cfg.DB.RetryInitialBackoff до cfg.DB.RetryMaxBackoff со случайным разбросом
+// (full jitter), чтобы воркеры не повторяли конфликтующие транзакции одновременно
+func retryBackoff(attempt int) time.Duration {
+	d := cfg.DB.RetryInitialBackoff
+	for i := 1; i < attempt && d < cfg.DB.RetryMaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, cfg.DB.RetryMaxBackoff)
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d) + 1
+}
+
+// withDBRetry выполняет fn, повторяя её при временных ошибках до cfg.DB.RetryAttempts раз.
+// Каждая попытка учитывается в orders_db_save_attempts_total. Повторы прекращаются,
+// если ошибка постоянная, запись прервана (isInterruptedDBError) или сервис
+// останавливается; возвращается последняя ошибка.
+func withDBRetry(ctx context.Context, fn func() error) error {
+	span := trace.SpanFromContext(ctx)
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			dbSaveAttempts.WithLabelValues(attemptOK).Inc()
+			return nil
+		}
+		if isInterruptedDBError(err) {
+			dbSaveAttempts.WithLabelValues(attemptTransient).Inc()
+			return err
+		}
+		if !isTransientDBError(err) {
+			dbSaveAttempts.WithLabelValues(attemptPermanent).Inc()
+			return err
+		}
+		dbSaveAttempts.WithLabelValues(attemptTransient).Inc()
+
+		if attempt >= cfg.DB.RetryAttempts || shuttingDown.Load() {
+			return err
+		}
+
+		wait := retryBackoff(attempt)
+		dbTxRetries.Inc()
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("attempt", attempt),
+			attribute.String("error", err.Error()),
+		))
+		logFromContext(ctx).Warn("Временная ошибка БД, повтор",
+			"attempt", attempt, "backoff_ms", wait.Milliseconds(), errAttr(err))
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
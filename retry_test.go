@@ -0,0 +1,159 @@
+// retry_test.go
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestIsTransientDBError(t *testing.T) {
+	pgErr := func(code string) error { return &pgconn.PgError{Code: code} }
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"serialization failure", pgErr("40001"), true},
+		{"deadlock", pgErr("40P01"), true},
+		{"lock not available", pgErr("55P03"), true},
+		{"too many connections", pgErr("53300"), true},
+		{"admin shutdown", pgErr("57P01"), true},
+		{"crash shutdown", pgErr("57P02"), true},
+		{"cannot connect now", pgErr("57P03"), true},
+		{"connection exception", pgErr("08000"), true},
+		{"connection failure", pgErr("08006"), true},
+		{"protocol violation", pgErr("08P01"), true},
+		{"wrapped class 08", fmt.Errorf("запись заказа: %w", pgErr("08003")), true},
+		{"unique violation", pgErr("23505"), false},
+		{"check violation", pgErr("23514"), false},
+		{"query canceled", pgErr("57014"), false},
+		{"other class 40", pgErr("40000"), false},
+		{"net error", &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, true},
+		{"bad conn", driver.ErrBadConn, true},
+		{"conn done", sql.ErrConnDone, true},
+		{"eof", io.EOF, true},
+		{"wrapped unexpected eof", fmt.Errorf("чтение: %w", io.ErrUnexpectedEOF), true},
+		{"deadline", context.DeadlineExceeded, true},
+		{"canceled", context.Canceled, false},
+		{"no rows", sql.ErrNoRows, false},
+		{"plain error", errors.New("некорректные данные"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientDBError(tt.err); got != tt.want {
+				t.Fatalf("isTransientDBError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsInterruptedDBError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"canceled", context.Canceled, true},
+		{"wrapped canceled", fmt.Errorf("запись заказа: %w", context.Canceled), true},
+		{"database closed", errors.New("sql: database is closed"), true},
+		{"wrapped database closed", fmt.Errorf("begin: %w", errors.New("sql: database is closed")), true},
+		{"deadline", context.DeadlineExceeded, false},
+		{"conn done", sql.ErrConnDone, false},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isInterruptedDBError(tt.err); got != tt.want {
+				t.Fatalf("isInterruptedDBError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+
+	// Закрытый пул database/sql возвращает именно эту ошибку
+	db, err := sql.Open("pgx", "postgresql://localhost/orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if _, err := db.Exec("SELECT 1"); !isInterruptedDBError(err) {
+		t.Fatalf("ошибка закрытого пула %v не распознана", err)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	prev := cfg.DB
+	t.Cleanup(func() { cfg.DB = prev })
+	cfg.DB.RetryInitialBackoff, cfg.DB.RetryMaxBackoff = 100*time.Millisecond, time.Second
+
+	tests := []struct {
+		attempt int
+		limit   time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	}
+	for _, tt := range tests {
+		for range 100 {
+			if d := retryBackoff(tt.attempt); d <= 0 || d > tt.limit {
+				t.Fatalf("retryBackoff(%d) = %v, ожидалось от 0 до %v", tt.attempt, d, tt.limit)
+			}
+		}
+	}
+
+	cfg.DB.RetryInitialBackoff, cfg.DB.RetryMaxBackoff = 0, 0
+	if d := retryBackoff(3); d != 0 {
+		t.Fatalf("retryBackoff без пауз = %v, want 0", d)
+	}
+}
+
+func TestWithDBRetry(t *testing.T) {
+	prev := cfg.DB
+	t.Cleanup(func() { cfg.DB = prev })
+	cfg.DB.RetryAttempts = 3
+	cfg.DB.RetryInitialBackoff, cfg.DB.RetryMaxBackoff = time.Millisecond, time.Millisecond
+
+	transient := &pgconn.PgError{Code: "40001"}
+	permanent := &pgconn.PgError{Code: "23505"}
+	tests := []struct {
+		name      string
+		errs      []error // ошибки попыток по порядку; после них — успех
+		wantCalls int
+		wantErr   error
+	}{
+		{"success", nil, 1, nil},
+		{"transient then success", []error{transient, transient}, 3, nil},
+		{"attempts exhausted", []error{transient, transient, transient, transient}, 3, transient},
+		{"permanent not retried", []error{permanent}, 1, permanent},
+		{"transient then permanent", []error{transient, permanent}, 2, permanent},
+		{"canceled not retried", []error{transient, context.Canceled}, 2, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := withDBRetry(context.Background(), func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+			if err != tt.wantErr || calls != tt.wantCalls {
+				t.Fatalf("withDBRetry() = %v после %d попыток, want %v после %d", err, calls, tt.wantErr, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+// search.go
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Поля, по которым можно искать заказ
+const (
+	searchAny         = "any"
+	searchOrderUID    = "order_uid"
+	searchTrack       = "track_number"
+	searchTransaction = "transaction"
+	searchCustomer    = "customer_id"
+	searchPhone       = "phone"
+)
+
+// Вторичные индексы кэша
+var secondaryFields = []string{searchTrack, searchTransaction, searchCustomer, searchPhone}
+
+// Колонка orders для поиска по полю в БД
+var searchColumns = map[string]string{
+	searchTrack:       "track_number",
+	searchTransaction: "payment_transaction",
+	searchCustomer:    "customer_id",
+	searchPhone:       "regexp_replace(delivery_phone, '[^0-9]', '', 'g')",
+}
+
+// Максимум заказов в результате поиска
+const searchLimit = 100
+
+// secondaryKeys возвращает значения вторичных индексов заказа
+func secondaryKeys(o Order) map[string]string {
+	return map[string]string{
+		searchTrack:       o.TrackNumber,
+		searchTransaction: o.PaymentTransaction,
+		searchCustomer:    o.CustomerID,
+		searchPhone:       normalizePhone(o.DeliveryPhone),
+	}
+}
+
+// normalizePhone оставляет в номере только цифры, чтобы "+7 (900) 000-00-00" и "79000000000" совпадали
+func normalizePhone(phone string) string {
+	var b strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// sortOrders упорядочивает результат поиска от новых к старым: по date_created,
+// при равенстве — по id и order_uid
+func sortOrders(orders []Order) {
+	slices.SortFunc(orders, func(a, b Order) int {
+		if c := b.DateCreated.Compare(a.DateCreated); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.ID, a.ID); c != 0 {
+			return c
+		}
+		return strings.Compare(a.OrderUID, b.OrderUID)
+	})
+}
+
+// searchOrderUIDs возвращает order_uid заказов из БД, у которых колонка равна значению,
+// в порядке sortOrders
+var searchOrderUIDs = queryOrderUIDs
+
+// searchOrders ищет заказы по значению поля. Когда в кэше все заказы из БД
+// (cache.Complete), вторичные поля ищутся по индексам кэша. Иначе часть заказов
+// может быть вытеснена, и поиск идёт по БД, а сами заказы берутся через cache.Get.
+func searchOrders(ctx context.Context, field, value string) ([]Order, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	switch field {
+	case searchOrderUID:
+		if order, ok := cache.Get(ctx, value); ok {
+			return []Order{order}, nil
+		}
+		return nil, nil
+
+	case searchAny:
+		var result []Order
+		seen := make(map[string]bool)
+		for _, f := range append([]string{searchOrderUID}, secondaryFields...) {
+			orders, err := searchOrders(ctx, f, value)
+			if err != nil {
+				return nil, err
+			}
+			for _, o := range orders {
+				if !seen[o.OrderUID] {
+					seen[o.OrderUID] = true
+					result = append(result, o)
+				}
+			}
+		}
+		sortOrders(result)
+		return result, nil
+	}
+
+	column, ok := searchColumns[field]
+	if !ok {
+		return nil, fmt.Errorf("неизвестное поле поиска %q", field)
+	}
+	if field == searchPhone {
+		if value = normalizePhone(value); value == "" {
+			return nil, nil
+		}
+	}
+
+	if cache.Complete() {
+		return cache.Lookup(field, value, searchLimit), nil
+	}
+
+	uids, err := searchOrderUIDs(ctx, column, value, searchLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []Order
+	for _, uid := range uids {
+		if order, ok := cache.Get(ctx, uid); ok {
+			orders = append(orders, order)
+		}
+	}
+	// Заказ в кэше может быть новее строки, по которой его нашли
+	sortOrders(orders)
+	return orders, nil
+}
+
+func queryOrderUIDs(ctx context.Context, column, value string, limit int) ([]string, error) {
+	ctx, span := startSQLSpan(ctx, "SELECT", "orders")
+	rows, err := DB.QueryContext(ctx, `SELECT order_uid FROM orders WHERE `+column+` = $1 ORDER BY date_created DESC, id DESC, order_uid LIMIT $2`, value, limit)
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var uids []string
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			return nil, err
+		}
+		uids = append(uids, uid)
+	}
+	return uids, rows.Err()
+}
+
+// GET /api/orders/search?q=...&by=any|order_uid|track_number|transaction|customer_id|phone
+func apiSearchHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = searchAny
+	}
+	if query == "" {
+		http.Error(w, "Не задан параметр q", http.StatusBadRequest)
+		return
+	}
+	if _, ok := searchColumns[by]; !ok && by != searchAny && by != searchOrderUID {
+		http.Error(w, "Неизвестное поле поиска", http.StatusBadRequest)
+		return
+	}
+
+	orders, err := searchOrders(r.Context(), by, query)
+	if err != nil {
+		logFromContext(r.Context()).Error("Ошибка поиска заказов", "by", by, "query", query, errAttr(err))
+		http.Error(w, "Ошибка поиска", http.StatusInternalServerError)
+		return
+	}
+	if orders == nil {
+		orders = []Order{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
@@ -0,0 +1,140 @@
+// search_test.go
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// setupSearch подменяет кэш и запрос к БД: db — заказы «в БД», maxEntries — размер кэша
+func setupSearch(t *testing.T, maxEntries int, db []Order) {
+	t.Helper()
+
+	byUID := make(map[string]Order)
+	for _, o := range db {
+		byUID[o.OrderUID] = o
+	}
+	loader := func(ctx context.Context, uid string) (Order, bool, error) {
+		o, ok := byUID[uid]
+		return o, ok, nil
+	}
+
+	prevCache, prevQuery := cache, searchOrderUIDs
+	t.Cleanup(func() { cache, searchOrderUIDs = prevCache, prevQuery })
+
+	cache = NewOrderCache(maxEntries, 0, loader)
+	searchOrderUIDs = func(ctx context.Context, column, value string, limit int) ([]string, error) {
+		var found []Order
+		for _, o := range db {
+			if column == searchColumns[searchTrack] && o.TrackNumber == value ||
+				column == searchColumns[searchCustomer] && o.CustomerID == value {
+				found = append(found, o)
+			}
+		}
+		sortOrders(found)
+		var uids []string
+		for _, o := range found {
+			uids = append(uids, o.OrderUID)
+		}
+		return uids, nil
+	}
+}
+
+// searchOrder — заказ для поиска, id задаёт порядок сохранения
+func searchOrder(id int64, uid, track, customer string, created time.Time) Order {
+	return Order{ID: id, OrderUID: uid, TrackNumber: track, CustomerID: customer, DateCreated: created}
+}
+
+func searchUIDs(t *testing.T, field, value string) []string {
+	t.Helper()
+	orders, err := searchOrders(context.Background(), field, value)
+	if err != nil {
+		t.Fatalf("searchOrders(%s, %s): %v", field, value, err)
+	}
+	var uids []string
+	for _, o := range orders {
+		uids = append(uids, o.OrderUID)
+	}
+	return uids
+}
+
+func TestSearchOrdersFindsEvicted(t *testing.T) {
+	day := time.Date(2021, 11, 26, 0, 0, 0, 0, time.UTC)
+	db := []Order{
+		searchOrder(1, "old", "TRACK", "alice", day),
+		searchOrder(2, "new", "TRACK", "bob", day.Add(time.Hour)),
+	}
+	setupSearch(t, 1, db)
+	cache.Set(db[0])
+	cache.Set(db[1]) // вытесняет "old"
+
+	if _, ok := cache.Peek("old"); ok {
+		t.Fatal(`заказ "old" должен быть вытеснен из кэша`)
+	}
+
+	tests := []struct {
+		name  string
+		field string
+		value string
+		want  []string
+	}{
+		{"cached and evicted", searchTrack, "TRACK", []string{"new", "old"}},
+		{"only evicted", searchCustomer, "alice", []string{"old"}},
+		{"any field", searchAny, "alice", []string{"old"}},
+		{"not found", searchCustomer, "carol", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := searchUIDs(t, tt.field, tt.value); !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchOrdersCompleteCache(t *testing.T) {
+	day := time.Date(2021, 11, 26, 0, 0, 0, 0, time.UTC)
+	db := []Order{
+		searchOrder(1, "b", "TRACK", "alice", day),
+		searchOrder(2, "a", "TRACK", "alice", day),
+		searchOrder(3, "late", "TRACK", "bob", day.Add(-time.Hour)),
+		searchOrder(4, "c", "TRACK", "carol", day),
+	}
+	setupSearch(t, 4, db)
+	for _, o := range db {
+		cache.Warm(o)
+	}
+	cache.MarkComplete()
+
+	queries := 0
+	dbQuery := searchOrderUIDs
+	searchOrderUIDs = func(ctx context.Context, column, value string, limit int) ([]string, error) {
+		queries++
+		return dbQuery(ctx, column, value, limit)
+	}
+
+	// Одинаковая дата — от последнего сохранённого, более ранняя дата — в конце
+	want := []string{"c", "a", "b", "late"}
+	for range 3 {
+		if got := searchUIDs(t, searchTrack, "TRACK"); !slices.Equal(got, want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if got := searchUIDs(t, searchAny, "alice"); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("any: got %v", got)
+	}
+	if queries != 0 {
+		t.Fatalf("полный кэш не должен обращаться к БД, запросов %d", queries)
+	}
+
+	// После вытеснения кэш не полон, и поиск снова идёт в БД с тем же порядком
+	cache.Set(searchOrder(5, "new", "OTHER", "dave", day))
+	if cache.Complete() {
+		t.Fatal("кэш с вытесненным заказом считается полным")
+	}
+	if got := searchUIDs(t, searchTrack, "TRACK"); !slices.Equal(got, want) || queries != 1 {
+		t.Fatalf("got %v, want %v, запросов %d", got, want, queries)
+	}
+}
@@ -0,0 +1,114 @@
+// shutdown.go
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/nats-io/stan.go"
+)
+
+// Обработчики сообщений держат handlersGate на чтение. Остановка берёт его на запись:
+// это дожидается завершения всех начатых обработчиков, а пришедшие позже сообщения
+// видят stopping и возвращаются без подтверждения (NATS доставит их после перезапуска).
+var (
+	handlersGate sync.RWMutex
+	stopping     bool
+)
+
+// enterHandler вызывается в начале обработки сообщения; false — сервис останавливается
+func enterHandler() bool {
+	handlersGate.RLock()
+	if stopping {
+		handlersGate.RUnlock()
+		return false
+	}
+	return true
+}
+
+func leaveHandler() {
+	handlersGate.RUnlock()
+}
+
+// drainHandlers запрещает обработку новых сообщений и ждёт завершения начатых
+func drainHandlers(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		handlersGate.Lock()
+		stopping = true
+		handlersGate.Unlock()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shutdown останавливает сервис по шагам в пределах cfg.ShutdownTimeout:
+// подписка → начатые обработчики → replay → воркеры → последний пакет → HTTP-сервер → NATS → пул соединений с БД → трассы
+func shutdown(pool *messagePool, sub stan.Subscription, sc stan.Conn, srv *http.Server, shutdownTracing func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// /readyz сразу начинает отвечать 503, чтобы балансировщик снял трафик
+	shuttingDown.Store(true)
+
+	// Подписка закрывается первой, чтобы сервер NATS перестал присылать сообщения.
+	// Close, а не Unsubscribe: durable-подписка сохраняет позицию на сервере.
+	// Подтвердить сообщения после этого уже нельзя: записанные, но не подтверждённые
+	// заказы придут повторно и будут только подтверждены по журналу processed_messages.
+	if err := sub.Close(); err != nil {
+		slog.Warn("Ошибка закрытия подписки", errAttr(err))
+	}
+
+	slog.Info("Остановка: ожидание обработки начатых сообщений")
+	if err := drainHandlers(ctx); err != nil {
+		slog.Warn("Не дождались обработчиков сообщений", errAttr(err))
+	}
+
+	// Повторная обработка канала прерывается; её можно запустить заново с last_seq
+	stopReplay()
+
+	// Сообщения, оставшиеся в очередях воркеров, не подтверждены и придут повторно
+	if err := pool.Stop(ctx); err != nil {
+		slog.Warn("Не дождались остановки воркеров", "queued", pool.QueueLen(), errAttr(err))
+	}
+
+	// Накопленный пакет записывается, чтобы не повторять его запись после перезапуска
+	if batcher != nil {
+		if err := batcher.Stop(ctx); err != nil {
+			slog.Warn("Не дождались записи последнего пакета", errAttr(err))
+		}
+	}
+
+	slog.Info("Остановка веб-сервера")
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("Ошибка остановки веб-сервера", errAttr(err))
+	}
+
+	if err := sc.Close(); err != nil {
+		slog.Warn("Ошибка закрытия соединения с NATS", errAttr(err))
+	}
+
+	if err := DB.Close(); err != nil {
+		slog.Warn("Ошибка закрытия соединений с БД", errAttr(err))
+	}
+
+	// Отправка оставшихся спанов в коллектор
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("Ошибка выгрузки трасс", errAttr(err))
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		slog.Warn("Остановка не уложилась в срок", "shutdown_timeout", cfg.ShutdownTimeout.String())
+		return
+	}
+	slog.Info("Сервис остановлен")
+}
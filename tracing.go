@@ -0,0 +1,195 @@
+// tracing.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Экспортёры трасс
+const (
+	traceExporterNone   = "none"
+	traceExporterStdout = "stdout"
+	traceExporterOTLP   = "otlp"
+)
+
+var (
+	tracer     = otel.Tracer("order-service")
+	propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+)
+
+// initTracing настраивает экспорт трасс; возвращает функцию, сбрасывающую
+// оставшиеся спаны при остановке сервиса
+func initTracing(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Tracing.Exporter {
+	case traceExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case traceExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case traceExporterOTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Tracing.OTLPEndpoint)}
+		if cfg.Tracing.OTLPInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("неизвестный экспортёр трасс %q", cfg.Tracing.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.Tracing.ServiceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.Tracing.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// messageTraceContext — контекст трассировки W3C во входящем сообщении.
+// NATS Streaming не поддерживает заголовки, поэтому производитель может передать
+// traceparent/tracestate полями верхнего уровня JSON; если их нет, начинается новая трасса.
+type messageTraceContext struct {
+	TraceParent string `json:"traceparent"`
+	TraceState  string `json:"tracestate"`
+}
+
+// extractMessageContext восстанавливает родительский спан из полей сообщения
+func extractMessageContext(ctx context.Context, data []byte) context.Context {
+	var tc messageTraceContext
+	if err := json.Unmarshal(data, &tc); err != nil || tc.TraceParent == "" {
+		return ctx
+	}
+	carrier := propagation.MapCarrier{"traceparent": tc.TraceParent}
+	if tc.TraceState != "" {
+		carrier["tracestate"] = tc.TraceState
+	}
+	return propagator.Extract(ctx, carrier)
+}
+
+// injectMessageContext возвращает поля traceparent/tracestate текущего спана для публикации
+func injectMessageContext(ctx context.Context) messageTraceContext {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return messageTraceContext{TraceParent: carrier["traceparent"], TraceState: carrier["tracestate"]}
+}
+
+// withMessageContext записывает в JSON-объект сообщения поля traceparent/tracestate
+// текущего спана, заменяя прежние. Если активного спана нет, сообщение не меняется;
+// если сообщение — не JSON-объект, оно возвращается без изменений вместе с ошибкой.
+func withMessageContext(ctx context.Context, data []byte) ([]byte, error) {
+	tc := injectMessageContext(ctx)
+	if tc.TraceParent == "" {
+		return data, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return data, err
+	}
+	if fields == nil {
+		return data, fmt.Errorf("сообщение не является JSON-объектом")
+	}
+
+	fields["traceparent"], _ = json.Marshal(tc.TraceParent)
+	delete(fields, "tracestate")
+	if tc.TraceState != "" {
+		fields["tracestate"], _ = json.Marshal(tc.TraceState)
+	}
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return data, err
+	}
+	return out, nil
+}
+
+// startSQLSpan начинает спан для одного SQL-запроса
+func startSQLSpan(ctx context.Context, operation, table string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, operation+" "+table,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(operation),
+			semconv.DBCollectionName(table),
+		),
+	)
+}
+
+// endSpan завершает спан, отмечая ошибку, если она есть
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracingMiddleware создаёт серверный спан на каждый HTTP-запрос; контекст
+// берётся из заголовков traceparent/tracestate, если клиент их передал
+func tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.URL.Path
+		if cur := mux.CurrentRoute(r); cur != nil {
+			if tpl, err := cur.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
+
+// messageSpanAttributes — атрибуты спана обработки сообщения
+func messageSpanAttributes(channel string, seq uint64, redelivered bool) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.MessagingSystemKey.String("nats-streaming"),
+		semconv.MessagingDestinationName(channel),
+		semconv.MessagingMessageID(fmt.Sprint(seq)),
+		attribute.Bool("messaging.nats.redelivered", redelivered),
+	}
+}
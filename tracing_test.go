@@ -0,0 +1,85 @@
+// tracing_test.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func spanContext(t *testing.T, state string) context.Context {
+	t.Helper()
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ts, err := trace.ParseTraceState(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		TraceState: ts,
+	})
+	return trace.ContextWithSpanContext(context.Background(), sc)
+}
+
+func TestMessageContextRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		state string
+		data  string
+	}{
+		{"no tracestate", "", `{"order_uid":"b563feb7b2b84b6test"}`},
+		{"with tracestate", "vendor=value", `{"order_uid":"b563feb7b2b84b6test"}`},
+		{"replaces old context", "", `{"order_uid":"b563feb7b2b84b6test","traceparent":"00-11111111111111111111111111111111-2222222222222222-01","tracestate":"old=1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := spanContext(t, tt.state)
+			want := trace.SpanContextFromContext(ctx)
+
+			data, err := withMessageContext(ctx, []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := trace.SpanContextFromContext(extractMessageContext(context.Background(), data))
+			if !got.IsRemote() || got.TraceID() != want.TraceID() || got.SpanID() != want.SpanID() ||
+				got.TraceFlags() != want.TraceFlags() || got.TraceState().String() != want.TraceState().String() {
+				t.Fatalf("extract(inject()) = %v, want %v", got, want)
+			}
+
+			var order OrderJSON
+			if err := json.Unmarshal(data, &order); err != nil || order.OrderUID != "b563feb7b2b84b6test" {
+				t.Fatalf("поля заказа не сохранились: %s", data)
+			}
+		})
+	}
+}
+
+func TestWithMessageContextUnchanged(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		data    string
+		wantErr bool
+	}{
+		{"no span", context.Background(), `{"order_uid":"x"}`, false},
+		{"not json", spanContext(t, ""), `not json`, true},
+		{"json array", spanContext(t, ""), `[1,2]`, true},
+		{"json null", spanContext(t, ""), `null`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := withMessageContext(tt.ctx, []byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(data) != tt.data {
+				t.Fatalf("сообщение изменено: %s", data)
+			}
+		})
+	}
+}
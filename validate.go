@@ -0,0 +1,163 @@
+// validate.go
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FieldError — ошибка проверки одного поля; Field — путь в JSON, например "items[0].price"
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors — список ошибок проверки заказа
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	parts := make([]string, 0, len(v))
+	for _, e := range v {
+		parts = append(parts, e.Field+": "+e.Message)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (v *ValidationErrors) add(field, format string, args ...interface{}) {
+	*v = append(*v, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *ValidationErrors) required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, "обязательное поле")
+		return false
+	}
+	return true
+}
+
+func (v *ValidationErrors) nonNegative(field string, value int) {
+	if value < 0 {
+		v.add(field, "не может быть отрицательным (%d)", value)
+	}
+}
+
+var (
+	phoneRe  = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+	localeRe = regexp.MustCompile(`^[a-z]{2}([-_][A-Za-z]{2})?$`)
+)
+
+// Коды валют ISO 4217
+var iso4217 = map[string]bool{
+	"AED": true, "AFN": true, "ALL": true, "AMD": true, "ANG": true, "AOA": true, "ARS": true, "AUD": true,
+	"AWG": true, "AZN": true, "BAM": true, "BBD": true, "BDT": true, "BGN": true, "BHD": true, "BIF": true,
+	"BMD": true, "BND": true, "BOB": true, "BRL": true, "BSD": true, "BTN": true, "BWP": true, "BYN": true,
+	"BZD": true, "CAD": true, "CDF": true, "CHF": true, "CLP": true, "CNY": true, "COP": true, "CRC": true,
+	"CUP": true, "CVE": true, "CZK": true, "DJF": true, "DKK": true, "DOP": true, "DZD": true, "EGP": true,
+	"ERN": true, "ETB": true, "EUR": true, "FJD": true, "FKP": true, "GBP": true, "GEL": true, "GHS": true,
+	"GIP": true, "GMD": true, "GNF": true, "GTQ": true, "GYD": true, "HKD": true, "HNL": true, "HTG": true,
+	"HUF": true, "IDR": true, "ILS": true, "INR": true, "IQD": true, "IRR": true, "ISK": true, "JMD": true,
+	"JOD": true, "JPY": true, "KES": true, "KGS": true, "KHR": true, "KMF": true, "KPW": true, "KRW": true,
+	"KWD": true, "KYD": true, "KZT": true, "LAK": true, "LBP": true, "LKR": true, "LRD": true, "LSL": true,
+	"LYD": true, "MAD": true, "MDL": true, "MGA": true, "MKD": true, "MMK": true, "MNT": true, "MOP": true,
+	"MRU": true, "MUR": true, "MVR": true, "MWK": true, "MXN": true, "MYR": true, "MZN": true, "NAD": true,
+	"NGN": true, "NIO": true, "NOK": true, "NPR": true, "NZD": true, "OMR": true, "PAB": true, "PEN": true,
+	"PGK": true, "PHP": true, "PKR": true, "PLN": true, "PYG": true, "QAR": true, "RON": true, "RSD": true,
+	"RUB": true, "RWF": true, "SAR": true, "SBD": true, "SCR": true, "SDG": true, "SEK": true, "SGD": true,
+	"SHP": true, "SLE": true, "SOS": true, "SRD": true, "SSP": true, "STN": true, "SVC": true, "SYP": true,
+	"SZL": true, "THB": true, "TJS": true, "TMT": true, "TND": true, "TOP": true, "TRY": true, "TTD": true,
+	"TWD": true, "TZS": true, "UAH": true, "UGX": true, "USD": true, "UYU": true, "UZS": true, "VES": true,
+	"VND": true, "VUV": true, "WST": true, "XAF": true, "XCD": true, "XOF": true, "XPF": true, "YER": true,
+	"ZAR": true, "ZMW": true, "ZWL": true,
+}
+
+// validateOrder проверяет все поля заказа и возвращает список ошибок (nil, если заказ корректен).
+// Используется и сервисом при приёме сообщения, и публикатором перед отправкой.
+func validateOrder(o OrderJSON) ValidationErrors {
+	var errs ValidationErrors
+
+	errs.required("order_uid", o.OrderUID)
+	errs.required("track_number", o.TrackNumber)
+	errs.required("entry", o.Entry)
+	errs.required("customer_id", o.CustomerID)
+	errs.required("delivery_service", o.DeliveryService)
+	if errs.required("locale", o.Locale) && !localeRe.MatchString(o.Locale) {
+		errs.add("locale", "некорректная локаль %q", o.Locale)
+	}
+	if o.SmID < 0 {
+		errs.add("sm_id", "не может быть отрицательным (%d)", o.SmID)
+	}
+	if o.ProducerVersion < 0 {
+		errs.add("producer_version", "не может быть отрицательным (%d)", o.ProducerVersion)
+	}
+	if errs.required("date_created", o.DateCreated) {
+		if _, err := time.Parse(time.RFC3339, o.DateCreated); err != nil {
+			errs.add("date_created", "ожидается дата в формате RFC 3339, получено %q", o.DateCreated)
+		}
+	}
+
+	validateDelivery(&errs, o.Delivery)
+	validatePayment(&errs, o.Payment)
+
+	if len(o.Items) == 0 {
+		errs.add("items", "заказ должен содержать хотя бы одну позицию")
+	}
+	for i, item := range o.Items {
+		validateItem(&errs, fmt.Sprintf("items[%d]", i), item)
+	}
+
+	return errs
+}
+
+func validateDelivery(errs *ValidationErrors, d Delivery) {
+	errs.required("delivery.name", d.Name)
+	if errs.required("delivery.phone", d.Phone) && !phoneRe.MatchString(d.Phone) {
+		errs.add("delivery.phone", "некорректный номер телефона %q", d.Phone)
+	}
+	errs.required("delivery.zip", d.Zip)
+	errs.required("delivery.city", d.City)
+	errs.required("delivery.address", d.Address)
+	errs.required("delivery.region", d.Region)
+	if errs.required("delivery.email", d.Email) {
+		if addr, err := mail.ParseAddress(d.Email); err != nil || addr.Address != d.Email {
+			errs.add("delivery.email", "некорректный e-mail %q", d.Email)
+		}
+	}
+}
+
+func validatePayment(errs *ValidationErrors, p Payment) {
+	errs.required("payment.transaction", p.Transaction)
+	if errs.required("payment.currency", p.Currency) && !iso4217[p.Currency] {
+		errs.add("payment.currency", "неизвестный код валюты ISO 4217 %q", p.Currency)
+	}
+	errs.required("payment.provider", p.Provider)
+	errs.nonNegative("payment.amount", p.Amount)
+	if p.PaymentDt <= 0 {
+		errs.add("payment.payment_dt", "ожидается Unix-время больше нуля")
+	}
+	errs.nonNegative("payment.delivery_cost", p.DeliveryCost)
+	errs.nonNegative("payment.goods_total", p.GoodsTotal)
+	errs.nonNegative("payment.custom_fee", p.CustomFee)
+}
+
+func validateItem(errs *ValidationErrors, path string, item ItemJSON) {
+	if item.ChrtID <= 0 {
+		errs.add(path+".chrt_id", "ожидается положительное число")
+	}
+	errs.required(path+".track_number", item.TrackNumber)
+	errs.nonNegative(path+".price", item.Price)
+	errs.required(path+".rid", item.Rid)
+	errs.required(path+".name", item.Name)
+	if item.Sale < 0 || item.Sale > 100 {
+		errs.add(path+".sale", "скидка должна быть от 0 до 100, получено %d", item.Sale)
+	}
+	errs.nonNegative(path+".total_price", item.TotalPrice)
+	if item.NmID <= 0 {
+		errs.add(path+".nm_id", "ожидается положительное число")
+	}
+	if item.Status < 0 {
+		errs.add(path+".status", "не может быть отрицательным (%d)", item.Status)
+	}
+}
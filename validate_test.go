@@ -0,0 +1,52 @@
+// validate_test.go
+package main
+
+import "testing"
+
+func TestValidateOrder(t *testing.T) {
+	checkOrderCases(t, []orderCase{
+		{"valid", func(o *OrderJSON) {}, nil},
+		{"blank order_uid", func(o *OrderJSON) { o.OrderUID = "  " }, []string{"order_uid"}},
+		{"locale with region", func(o *OrderJSON) { o.Locale = "ru-RU" }, nil},
+		{"bad locale", func(o *OrderJSON) { o.Locale = "english" }, []string{"locale"}},
+		{"empty locale reported once", func(o *OrderJSON) { o.Locale = "" }, []string{"locale"}},
+		{"negative sm_id", func(o *OrderJSON) { o.SmID = -1 }, []string{"sm_id"}},
+		{"negative producer_version", func(o *OrderJSON) { o.ProducerVersion = -1 }, []string{"producer_version"}},
+		{"date not RFC 3339", func(o *OrderJSON) { o.DateCreated = "2021-11-26 06:22:19" }, []string{"date_created"}},
+		{"date with offset", func(o *OrderJSON) { o.DateCreated = "2021-11-26T09:22:19+03:00" }, nil},
+		{"phone without plus", func(o *OrderJSON) { o.Delivery.Phone = "79000000000" }, nil},
+		{"phone too short", func(o *OrderJSON) { o.Delivery.Phone = "+123456" }, []string{"delivery.phone"}},
+		{"phone with spaces", func(o *OrderJSON) { o.Delivery.Phone = "+7 900 000 00 00" }, []string{"delivery.phone"}},
+		{"email with name", func(o *OrderJSON) { o.Delivery.Email = "Test <test@gmail.com>" }, []string{"delivery.email"}},
+		{"bad email", func(o *OrderJSON) { o.Delivery.Email = "test" }, []string{"delivery.email"}},
+		{"lowercase currency", func(o *OrderJSON) { o.Payment.Currency = "usd" }, []string{"payment.currency"}},
+		{"unknown currency", func(o *OrderJSON) { o.Payment.Currency = "XXX" }, []string{"payment.currency"}},
+		{"zero payment_dt", func(o *OrderJSON) { o.Payment.PaymentDt = 0 }, []string{"payment.payment_dt"}},
+		{"zero amount", func(o *OrderJSON) { o.Payment.Amount = 0 }, nil},
+		{"negative amounts", func(o *OrderJSON) {
+			o.Payment.Amount, o.Payment.DeliveryCost, o.Payment.GoodsTotal, o.Payment.CustomFee = -1, -1, -1, -1
+		}, []string{"payment.amount", "payment.delivery_cost", "payment.goods_total", "payment.custom_fee"}},
+		{"no items", func(o *OrderJSON) { o.Items = nil }, []string{"items"}},
+		{"sale 0 and 100", func(o *OrderJSON) {
+			o.Items = append(o.Items, o.Items[0])
+			o.Items[0].Sale, o.Items[1].Sale = 0, 100
+		}, nil},
+		{"sale above 100", func(o *OrderJSON) { o.Items[0].Sale = 101 }, []string{"items[0].sale"}},
+		{"second item path", func(o *OrderJSON) {
+			o.Items = append(o.Items, o.Items[0])
+			o.Items[1].ChrtID, o.Items[1].NmID = 0, 0
+		}, []string{"items[1].chrt_id", "items[1].nm_id"}},
+		{"negative status", func(o *OrderJSON) { o.Items[0].Status = -1 }, []string{"items[0].status"}},
+	}, validateOrder)
+}
+
+func TestValidationErrorsError(t *testing.T) {
+	var errs ValidationErrors
+	errs.add("order_uid", "обязательное поле")
+	errs.add("items[0].sale", "скидка должна быть от 0 до 100, получено %d", 101)
+
+	want := "order_uid: обязательное поле; items[0].sale: скидка должна быть от 0 до 100, получено 101"
+	if got := errs.Error(); got != want {
+		t.Fatalf("Error() = %q, want %q", got, want)
+	}
+}
@@ -3,43 +3,102 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Обработчик главной страницы с формой поиска
 func listOrdersHandler(w http.ResponseWriter, r *http.Request) {
 	// Получаем результат поиска (если есть)
 	query := r.URL.Query().Get("q")
-	var foundOrder *Order = nil
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = searchAny
+	}
 
+	var foundOrders []Order
 	if query != "" {
-		cacheMutex.RLock()
-		if order, exists := cache[query]; exists {
-			foundOrder = &order
+		var err error
+		if foundOrders, err = searchOrders(r.Context(), by, query); err != nil {
+			logFromContext(r.Context()).Error("Ошибка поиска заказов", "by", by, "query", query, errAttr(err))
+		}
+	}
+
+	// Формируем страницу списка заказов с фильтрами и сортировкой
+	params, err := parseListParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	orders, total, err := listOrdersPage(params)
+	if err != nil {
+		logFromContext(r.Context()).Error("Ошибка чтения списка заказов", errAttr(err))
+		http.Error(w, "Ошибка чтения из БД", http.StatusInternalServerError)
+		return
+	}
+
+	q := r.URL.Query()
+	pages := (total + params.PerPage - 1) / params.PerPage
+	var prevURL, nextURL string
+	if params.Page > 1 {
+		prevURL = listURL(q, "page", strconv.Itoa(params.Page-1))
+	}
+	if params.Page < pages {
+		nextURL = listURL(q, "page", strconv.Itoa(params.Page+1))
+	}
+
+	// Ссылки в заголовках таблицы: повторный клик меняет направление сортировки
+	sortURLs := make(map[string]string, len(listSortColumns))
+	for key := range listSortColumns {
+		dir := "asc"
+		if key == params.Sort && !params.Desc {
+			dir = "desc"
 		}
-		cacheMutex.RUnlock()
+		sortURLs[key] = listURL(q, "sort", key, "dir", dir, "page", "")
 	}
 
-	// Формируем список всех заказов для отображения
-	cacheMutex.RLock()
-	orders := make([]Order, 0, len(cache))
-	for _, order := range cache {
-		orders = append(orders, order)
+	itemStatus := ""
+	if params.Filter.ItemStatus != nil {
+		itemStatus = strconv.Itoa(*params.Filter.ItemStatus)
 	}
-	cacheMutex.RUnlock()
 
 	data := struct {
 		Orders      []Order
 		SearchQuery string
-		FoundOrder  *Order
+		SearchBy    string
+		FoundOrders []Order
+		Params      listParams
+		Query       url.Values
+		ItemStatus  string
+		Total       int
+		Pages       int
+		PrevURL     string
+		NextURL     string
+		SortURLs    map[string]string
+
+		PerPageOptions []int
 	}{
 		Orders:      orders,
 		SearchQuery: query,
-		FoundOrder:  foundOrder,
+		SearchBy:    by,
+		FoundOrders: foundOrders,
+		Params:      params,
+		Query:       q,
+		ItemStatus:  itemStatus,
+		Total:       total,
+		Pages:       pages,
+		PrevURL:     prevURL,
+		NextURL:     nextURL,
+		SortURLs:    sortURLs,
+
+		PerPageOptions: []int{20, 50, 100, 200},
 	}
 
 	tmpl := `
@@ -57,45 +116,83 @@ func listOrdersHandler(w http.ResponseWriter, r *http.Request) {
 		a:hover { text-decoration: underline; }
 		form { margin-bottom: 20px; }
 		input[type="text"] { padding: 6px; width: 300px; }
+		select { padding: 6px; }
 		input[type="submit"] { padding: 6px 12px; }
+		.filters input, .filters select { padding: 4px; margin-right: 8px; }
+		.filters input[type="text"] { width: 120px; }
+		.pager { margin-top: 15px; }
+		.pager a, .pager span { margin-right: 12px; }
 		.result { margin-top: 20px; padding: 15px; background-color: #e9f7ef; border: 1px solid #27ae60; }
+		tr.flagged { background-color: #fdecea; }
 	</style>
 </head>
 <body>
 	<h1>Список заказов</h1>
 
 	<form method="GET">
-		<label for="q">Поиск по Order UID:</label><br>
-		<input type="text" id="q" name="q" value="{{.SearchQuery}}" placeholder="Введите order_uid">
+		<label for="q">Поиск заказа:</label><br>
+		<input type="text" id="q" name="q" value="{{.SearchQuery}}" placeholder="order_uid, трек, транзакция, клиент или телефон">
+		<select name="by">
+			<option value="any"{{if eq .SearchBy "any"}} selected{{end}}>Любое поле</option>
+			<option value="order_uid"{{if eq .SearchBy "order_uid"}} selected{{end}}>Order UID</option>
+			<option value="track_number"{{if eq .SearchBy "track_number"}} selected{{end}}>Трек-номер</option>
+			<option value="transaction"{{if eq .SearchBy "transaction"}} selected{{end}}>Транзакция</option>
+			<option value="customer_id"{{if eq .SearchBy "customer_id"}} selected{{end}}>Клиент</option>
+			<option value="phone"{{if eq .SearchBy "phone"}} selected{{end}}>Телефон</option>
+		</select>
 		<input type="submit" value="Найти">
 	</form>
 
-	{{if .FoundOrder}}
+	{{if .SearchQuery}}
 	<div class="result">
-		<h2>Найден заказ:</h2>
-		<p><strong>Order UID:</strong> {{.FoundOrder.OrderUID}}</p>
-		<p><strong>Трек:</strong> {{.FoundOrder.TrackNumber}}</p>
-		<p><strong>Клиент:</strong> {{.FoundOrder.DeliveryName}} ({{.FoundOrder.DeliveryCity}})</p>
-		<p><strong>Дата:</strong> {{.FoundOrder.DateCreated.Format "2006-01-02 15:04:05"}}</p>
-		<p><strong>Сумма:</strong> {{.FoundOrder.PaymentAmount}}</p>
-		<a href="/order/{{.FoundOrder.OrderUID}}">Просмотреть детали</a>
+		{{if .FoundOrders}}
+		<h2>Найдено заказов: {{len .FoundOrders}}</h2>
+		{{range .FoundOrders}}
+		<p>
+			<strong>Order UID:</strong> {{.OrderUID}} ·
+			<strong>Трек:</strong> {{.TrackNumber}} ·
+			<strong>Клиент:</strong> {{.DeliveryName}} ({{.DeliveryCity}}) ·
+			<strong>Дата:</strong> {{.DateCreated.Format "2006-01-02 15:04:05"}} ·
+			<strong>Сумма:</strong> {{.PaymentAmount}}
+			{{if .Flagged}}· <strong>⚠ Суммы не сходятся</strong>{{end}}
+			· <a href="/order/{{.OrderUID}}">Просмотреть детали</a>
+		</p>
+		{{end}}
+		{{else}}
+		<h2>Ничего не найдено</h2>
+		{{end}}
 	</div>
 	{{end}}
 
-	<h2>Все заказы</h2>
+	<h2>Все заказы ({{.Total}})</h2>
+	<form method="GET" class="filters">
+		<input type="hidden" name="sort" value="{{.Params.Sort}}">
+		<input type="hidden" name="dir" value="{{if .Params.Desc}}desc{{else}}asc{{end}}">
+		<label>С <input type="date" name="date_from" value="{{.Query.Get "date_from"}}"></label>
+		<label>по <input type="date" name="date_to" value="{{.Query.Get "date_to"}}"></label>
+		<label>Служба доставки <input type="text" name="delivery_service" value="{{.Params.Filter.DeliveryService}}"></label>
+		<label>Валюта <input type="text" name="currency" value="{{.Params.Filter.Currency}}" maxlength="3" style="width: 50px"></label>
+		<label>Город <input type="text" name="city" value="{{.Params.Filter.City}}"></label>
+		<label>Статус позиции <input type="text" name="item_status" value="{{.ItemStatus}}" style="width: 60px"></label>
+		<label>На странице <select name="per_page">
+			{{range $n := .PerPageOptions}}<option value="{{$n}}"{{if eq $n $.Params.PerPage}} selected{{end}}>{{$n}}</option>{{end}}
+		</select></label>
+		<input type="submit" value="Применить">
+		<a href="/">Сбросить</a>
+	</form>
 	<table>
 		<tr>
 			<th>Order UID</th>
 			<th>Трек</th>
-			<th>Клиент</th>
-			<th>Город</th>
-			<th>Дата</th>
-			<th>Сумма</th>
+			<th><a href="{{index .SortURLs "customer"}}">Клиент</a>{{template "arrow" (sortArrow .Params "customer")}}</th>
+			<th><a href="{{index .SortURLs "city"}}">Город</a>{{template "arrow" (sortArrow .Params "city")}}</th>
+			<th><a href="{{index .SortURLs "date"}}">Дата</a>{{template "arrow" (sortArrow .Params "date")}}</th>
+			<th><a href="{{index .SortURLs "amount"}}">Сумма</a>{{template "arrow" (sortArrow .Params "amount")}}</th>
 			<th>Действие</th>
 		</tr>
 		{{range .Orders}}
-		<tr>
-			<td>{{.OrderUID}}</td>
+		<tr{{if .Flagged}} class="flagged" title="Суммы не сходятся"{{end}}>
+			<td>{{if .Flagged}}⚠ {{end}}{{.OrderUID}}</td>
 			<td>{{.TrackNumber}}</td>
 			<td>{{.DeliveryName}}</td>
 			<td>{{.DeliveryCity}}</td>
@@ -105,11 +202,30 @@ func listOrdersHandler(w http.ResponseWriter, r *http.Request) {
 		</tr>
 		{{end}}
 	</table>
+
+	<div class="pager">
+		{{if .PrevURL}}<a href="{{.PrevURL}}">← Назад</a>{{end}}
+		<span>Страница {{.Params.Page}} из {{if .Pages}}{{.Pages}}{{else}}1{{end}}</span>
+		{{if .NextURL}}<a href="{{.NextURL}}">Вперёд →</a>{{end}}
+	</div>
 </body>
 </html>
+{{define "arrow"}}{{if eq . "asc"}} ▲{{else if eq . "desc"}} ▼{{end}}{{end}}
 `
 
-	t, _ := template.New("list").Parse(tmpl)
+	funcs := template.FuncMap{
+		// sortArrow возвращает направление сортировки для колонки или "", если сортировка не по ней
+		"sortArrow": func(p listParams, key string) string {
+			if p.Sort != key {
+				return ""
+			}
+			if p.Desc {
+				return "desc"
+			}
+			return "asc"
+		},
+	}
+	t, _ := template.New("list").Funcs(funcs).Parse(tmpl)
 	t.Execute(w, data)
 }
 
@@ -118,10 +234,7 @@ func orderDetailHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	uid := vars["uid"]
 
-	cacheMutex.RLock()
-	order, exists := cache[uid]
-	cacheMutex.RUnlock()
-
+	order, exists := cache.Get(r.Context(), uid)
 	if !exists {
 		http.Error(w, "Заказ не найден", http.StatusNotFound)
 		return
@@ -141,6 +254,7 @@ func orderDetailHandler(w http.ResponseWriter, r *http.Request) {
 		th, td { border: 1px solid #ddd; padding: 10px; text-align: left; }
 		th { background-color: #f2f2f2; }
 		a { color: #0066cc; }
+		.warning { margin: 15px 0; padding: 10px; background-color: #fdecea; border: 1px solid #e74c3c; }
 	</style>
 </head>
 <body>
@@ -149,6 +263,12 @@ func orderDetailHandler(w http.ResponseWriter, r *http.Request) {
 	<div class="info"><strong>Клиент:</strong> {{.DeliveryName}} ({{.DeliveryCity}})</div>
 	<div class="info"><strong>Дата:</strong> {{.DateCreated.Format "2006-01-02 15:04:05"}}</div>
 	<div class="info"><strong>Сумма:</strong> {{.PaymentAmount}}</div>
+	{{if .Flagged}}
+	<div class="warning">
+		<strong>⚠ Суммы заказа не сходятся:</strong>
+		<ul>{{range .FlagReasons}}<li>{{.}}</li>{{end}}</ul>
+	</div>
+	{{end}}
 
 	<h2>Товары</h2>
 	<table>
@@ -164,6 +284,7 @@ func orderDetailHandler(w http.ResponseWriter, r *http.Request) {
 		{{end}}
 	</table>
 	<br>
+	<a href="/order/{{.OrderUID}}/history">История изменений (версия {{.Version}})</a><br><br>
 	<a href="/">← Назад к списку</a>
 </body>
 </html>
@@ -178,10 +299,7 @@ func apiOrderHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	uid := vars["uid"]
 
-	cacheMutex.RLock()
-	order, exists := cache[uid]
-	cacheMutex.RUnlock()
-
+	order, exists := cache.Get(r.Context(), uid)
 	if !exists {
 		http.Error(w, "Заказ не найден", http.StatusNotFound)
 		return
@@ -191,13 +309,50 @@ func apiOrderHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(order)
 }
 
-// Запуск веб-сервера
-func StartWebServer() {
+// Счётчики кэша
+func apiCacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cache.Stats())
+}
+
+// Запуск веб-сервера в фоне; ошибка работы сервера (кроме штатной остановки) придёт в канал
+func StartWebServer() (*http.Server, <-chan error) {
 	r := mux.NewRouter()
+	r.Use(requestLogMiddleware, metricsMiddleware, tracingMiddleware)
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	r.HandleFunc("/healthz", healthzHandler).Methods("GET")
+	r.HandleFunc("/readyz", readyzHandler).Methods("GET")
+	r.HandleFunc("/status", statusHandler).Methods("GET")
 	r.HandleFunc("/", listOrdersHandler).Methods("GET")
 	r.HandleFunc("/order/{uid}", orderDetailHandler).Methods("GET")
+	r.HandleFunc("/order/{uid}/history", orderHistoryHandler).Methods("GET")
 	r.HandleFunc("/api/order/{uid}", apiOrderHandler).Methods("GET")
+	r.HandleFunc("/api/order/{uid}/history", apiOrderHistoryHandler).Methods("GET")
+	r.HandleFunc("/api/orders", apiOrdersHandler).Methods("GET")
+	r.HandleFunc("/api/orders/search", apiSearchHandler).Methods("GET")
+	r.HandleFunc("/api/cache/stats", apiCacheStatsHandler).Methods("GET")
+	r.HandleFunc("/api/rejects", listRejectsHandler).Methods("GET")
+	r.HandleFunc("/api/rejects/{id}", rejectDetailHandler).Methods("GET")
+	r.HandleFunc("/api/rejects/{id}/resubmit", resubmitRejectHandler).Methods("POST")
+	r.HandleFunc("/api/admin/replay", startReplayHandler).Methods("POST")
+	r.HandleFunc("/api/admin/replay", replayStatusHandler).Methods("GET")
+	r.HandleFunc("/api/admin/replay", cancelReplayHandler).Methods("DELETE")
+
+	srv := &http.Server{
+		Addr:         cfg.HTTP.Addr,
+		Handler:      r,
+		ReadTimeout:  cfg.HTTP.ReadTimeout,
+		WriteTimeout: cfg.HTTP.WriteTimeout,
+		IdleTimeout:  cfg.HTTP.IdleTimeout,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+	}()
 
-	log.Println("Веб-интерфейс доступен на http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", r))
+	slog.Info("Веб-интерфейс запущен", "addr", cfg.HTTP.Addr)
+	return srv, errCh
 }
\ No newline at end of file
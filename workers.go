@@ -0,0 +1,119 @@
+// workers.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+
+	"github.com/nats-io/stan.go"
+)
+
+// messagePool обрабатывает сообщения параллельно на фиксированном числе воркеров.
+// У каждого воркера своя очередь; сообщение направляется в очередь по хэшу order_uid,
+// поэтому обновления одного заказа применяются строго в порядке поступления.
+//
+// Если очередь воркера заполнена, Dispatch блокируется: клиент STAN перестаёт
+// забирать новые сообщения, а сервер — присылать их сверх MaxInflight неподтверждённых.
+type messagePool struct {
+	queues []chan *stan.Msg
+	handle func(*stan.Msg)
+	quit   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// Пул воркеров сервиса, создаётся в main
+var workerPool *messagePool
+
+func newMessagePool(workers, queueSize int, handle func(*stan.Msg)) *messagePool {
+	p := &messagePool{
+		queues: make([]chan *stan.Msg, workers),
+		handle: handle,
+		quit:   make(chan struct{}),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan *stan.Msg, queueSize)
+		p.wg.Add(1)
+		go p.run(p.queues[i])
+	}
+	return p
+}
+
+func (p *messagePool) run(queue <-chan *stan.Msg) {
+	defer p.wg.Done()
+	for {
+		select {
+		case msg := <-queue:
+			p.handle(msg)
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// Dispatch ставит сообщение в очередь воркера; используется как обработчик подписки STAN
+func (p *messagePool) Dispatch(msg *stan.Msg) {
+	queue := p.queues[p.worker(messageOrderUID(msg.Data))]
+	select {
+	case queue <- msg:
+		return
+	default:
+	}
+
+	workerQueueFull.Inc()
+	slog.Debug("Очередь воркера заполнена, приём сообщений приостановлен", logKeyNatsSeq, msg.Sequence)
+	select {
+	case queue <- msg:
+	case <-p.quit:
+		// Сервис останавливается: сообщение не подтверждено и будет доставлено повторно
+	}
+}
+
+// worker выбирает воркер по order_uid
+func (p *messagePool) worker(uid string) int {
+	h := fnv.New32a()
+	h.Write([]byte(uid))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+// QueueLen — число сообщений, ожидающих обработки во всех очередях
+func (p *messagePool) QueueLen() int {
+	n := 0
+	for _, q := range p.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// Stop останавливает воркеры после завершения текущих сообщений. Сообщения,
+// оставшиеся в очередях, не подтверждаются и будут доставлены повторно.
+// Если воркер не успел завершиться до срока ctx (например, завис в записи в БД),
+// Stop возвращает ошибку ctx, не дожидаясь его: остановка сервиса продолжается.
+func (p *messagePool) Stop(ctx context.Context) error {
+	close(p.quit)
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// messageOrderUID достаёт order_uid без полного разбора сообщения. Для некорректного
+// JSON возвращается пустая строка — такие сообщения попадают в один воркер и уходят в DLQ.
+func messageOrderUID(data []byte) string {
+	var key struct {
+		OrderUID string `json:"order_uid"`
+	}
+	json.Unmarshal(data, &key)
+	return key.OrderUID
+}
@@ -0,0 +1,217 @@
+// workers_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/stan.go"
+	"github.com/nats-io/stan.go/pb"
+)
+
+func testMsg(seq uint64, uid string) *stan.Msg {
+	return &stan.Msg{MsgProto: pb.MsgProto{Sequence: seq, Data: []byte(fmt.Sprintf(`{"order_uid":%q}`, uid))}}
+}
+
+func TestMessagePoolOrdersPerUID(t *testing.T) {
+	var mu sync.Mutex
+	active := make(map[string]int)
+	handled := make(map[string][]uint64)
+	var overlap []string
+
+	pool := newMessagePool(4, 4, func(msg *stan.Msg) {
+		uid := messageOrderUID(msg.Data)
+		mu.Lock()
+		if active[uid]++; active[uid] > 1 {
+			overlap = append(overlap, uid)
+		}
+		mu.Unlock()
+
+		time.Sleep(100 * time.Microsecond)
+
+		mu.Lock()
+		active[uid]--
+		handled[uid] = append(handled[uid], msg.Sequence)
+		mu.Unlock()
+	})
+
+	uids := []string{"a", "b", "c", "d", "e", "f"}
+	const perUID = 30
+	var seq uint64
+	for range perUID {
+		for _, uid := range uids {
+			seq++
+			pool.Dispatch(testMsg(seq, uid))
+		}
+	}
+
+	// Ждём, пока все сообщения будут обработаны, и останавливаем пул
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := 0
+		for _, seqs := range handled {
+			n += len(seqs)
+		}
+		mu.Unlock()
+		if n == len(uids)*perUID {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("обработано %d сообщений из %d", n, len(uids)*perUID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := pool.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(overlap) > 0 {
+		t.Fatalf("сообщения одного заказа обрабатывались параллельно: %v", overlap)
+	}
+	for _, uid := range uids {
+		seqs := handled[uid]
+		for i := 1; i < len(seqs); i++ {
+			if seqs[i] <= seqs[i-1] {
+				t.Fatalf("заказ %s: сообщения обработаны не по порядку: %v", uid, seqs)
+			}
+		}
+	}
+}
+
+func TestMessagePoolDispatchBlocksWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan uint64, 4)
+	pool := newMessagePool(1, 1, func(msg *stan.Msg) {
+		started <- msg.Sequence
+		<-release
+	})
+
+	pool.Dispatch(testMsg(1, "a"))
+	<-started // первое сообщение обрабатывается
+	pool.Dispatch(testMsg(2, "a"))
+	if pool.QueueLen() != 1 {
+		t.Fatalf("QueueLen() = %d, want 1", pool.QueueLen())
+	}
+
+	dispatched := make(chan struct{})
+	go func() {
+		pool.Dispatch(testMsg(3, "a"))
+		close(dispatched)
+	}()
+	select {
+	case <-dispatched:
+		t.Fatal("Dispatch в заполненную очередь не заблокировался")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release <- struct{}{}
+	select {
+	case <-dispatched:
+	case <-time.After(time.Second):
+		t.Fatal("Dispatch не продолжился после освобождения очереди")
+	}
+	if seq := <-started; seq != 2 {
+		t.Fatalf("вторым обработано сообщение %d", seq)
+	}
+	close(release)
+	if err := pool.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMessagePoolStop(t *testing.T) {
+	t.Run("waits for current message", func(t *testing.T) {
+		started := make(chan struct{})
+		var finished bool
+		pool := newMessagePool(2, 1, func(msg *stan.Msg) {
+			close(started)
+			time.Sleep(20 * time.Millisecond)
+			finished = true
+		})
+		pool.Dispatch(testMsg(1, "a"))
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := pool.Stop(ctx); err != nil {
+			t.Fatalf("Stop() = %v", err)
+		}
+		if !finished {
+			t.Fatal("Stop вернулся до завершения начатого сообщения")
+		}
+	})
+
+	t.Run("respects ctx", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		started := make(chan struct{})
+		pool := newMessagePool(1, 1, func(msg *stan.Msg) {
+			close(started)
+			<-release
+		})
+		pool.Dispatch(testMsg(1, "a"))
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if err := pool.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Stop() = %v, ожидалось превышение срока", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("Stop ждал %v при сроке 20ms", elapsed)
+		}
+	})
+
+	t.Run("unblocks dispatch", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		started := make(chan struct{})
+		pool := newMessagePool(1, 1, func(msg *stan.Msg) {
+			if msg.Sequence == 1 {
+				close(started)
+				<-release
+			}
+		})
+		pool.Dispatch(testMsg(1, "a"))
+		<-started
+		pool.Dispatch(testMsg(2, "a"))
+
+		dispatched := make(chan struct{})
+		go func() {
+			pool.Dispatch(testMsg(3, "a"))
+			close(dispatched)
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		pool.Stop(ctx)
+		select {
+		case <-dispatched:
+		case <-time.After(time.Second):
+			t.Fatal("Dispatch остался заблокированным после Stop")
+		}
+	})
+}
+
+func TestMessageOrderUID(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{`{"order_uid":"b563feb7b2b84b6test","track_number":"WBILMTESTTRACK"}`, "b563feb7b2b84b6test"},
+		{`{"track_number":"WBILMTESTTRACK"}`, ""},
+		{`{"order_uid":42}`, ""},
+		{`not json`, ""},
+	}
+	for _, tt := range tests {
+		if got := messageOrderUID([]byte(tt.data)); got != tt.want {
+			t.Errorf("messageOrderUID(%s) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}